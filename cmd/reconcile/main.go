@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/optimisticlock"
+	"github.com/dickidarmawansaputra/belajar-gorm/service"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// cek konsistensi balance wallet dengan ledgernya
+// go run ./cmd/reconcile -dsn "..." [--fix]
+func main() {
+	dsn := flag.String("dsn", "dickids:rahasia@tcp(127.0.0.1:3306)/belajar-gorm?charset=utf8mb4&parseTime=True&loc=Local", "dsn database mysql")
+	fix := flag.Bool("fix", false, "tulis entry koreksi untuk balance yang tidak sesuai ledger")
+	flag.Parse()
+
+	db, err := gorm.Open(mysql.Open(*dsn), &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Use(optimisticlock.Plugin{})
+	if err != nil {
+		panic(err)
+	}
+
+	report, err := service.NewWalletService(db).Reconcile(context.Background(), *fix)
+	if report != nil {
+		report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if report.HasIssues() {
+		os.Exit(1)
+	}
+}
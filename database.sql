@@ -94,4 +94,328 @@ CREATE TABLE user_like_product
     PRIMARY KEY (user_id, product_id),
     FOREIGN KEY (user_id) REFERENCES users (id),
     FOREIGN KEY (product_id) REFERENCES products (id)
-) ENGINE = InnoDB;
\ No newline at end of file
+) ENGINE = InnoDB;
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMP NULL AFTER updated_at;
+
+-- kolom terenkripsi butuh ukuran lebih besar dari plaintextnya
+ALTER TABLE users
+    MODIFY first_name VARCHAR(512) NOT NULL,
+    MODIFY middle_name VARCHAR(512) NOT NULL,
+    MODIFY last_name VARCHAR(512) NOT NULL,
+    ADD COLUMN first_name_bidx VARCHAR(64) NOT NULL DEFAULT '' AFTER last_name,
+    ADD INDEX users_first_name_bidx_index (first_name_bidx);
+
+ALTER TABLE addresses
+    MODIFY address VARCHAR(512) NOT NULL,
+    ADD COLUMN address_bidx VARCHAR(64) NOT NULL DEFAULT '' AFTER address,
+    ADD INDEX addresses_address_bidx_index (address_bidx);
+
+CREATE TABLE wallet_entries
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    wallet_id VARCHAR(100) NOT NULL,
+    amount BIGINT NOT NULL,
+    balance_after BIGINT NOT NULL,
+    reference_type VARCHAR(100) NOT NULL,
+    reference_id VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX wallet_entries_wallet_id_index (wallet_id, id),
+    FOREIGN KEY (wallet_id) REFERENCES wallets (id)
+) ENGINE = InnoDB;
+
+ALTER TABLE wallets
+    ADD COLUMN version BIGINT NOT NULL DEFAULT 1 AFTER deleted_at;
+
+ALTER TABLE todos
+    ADD COLUMN version BIGINT NOT NULL DEFAULT 1 AFTER description;
+
+CREATE TABLE idempotency_keys
+(
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    response TEXT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (idempotency_key),
+    INDEX idempotency_keys_expires_at_index (expires_at)
+) ENGINE = InnoDB;
+
+-- satu wallet per mata uang untuk setiap user
+ALTER TABLE wallets
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR' AFTER balance,
+    ADD UNIQUE INDEX wallets_user_id_currency_unique (user_id, currency);
+
+ALTER TABLE products
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR' AFTER price;
+
+-- mata uang entry ledger mengikuti wallet, amount dan balance_after dibaca sebagai money.Money
+ALTER TABLE wallet_entries
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR' AFTER balance_after;
+
+UPDATE wallet_entries
+    JOIN wallets ON wallets.id = wallet_entries.wallet_id
+SET wallet_entries.currency = wallets.currency;
+
+-- wallet yang sudah di soft delete tidak dihitung, supaya user bisa membuka lagi wallet dengan mata uang yang sama
+-- active_user_id bernilai NULL untuk wallet yang dihapus dan NULL tidak pernah bentrok di unique index
+-- index user_id dibuat dulu karna foreign key user_id butuh index setelah unique index lama dihapus
+ALTER TABLE wallets
+    ADD INDEX wallets_user_id_index (user_id);
+
+ALTER TABLE wallets
+    DROP INDEX wallets_user_id_currency_unique,
+    ADD COLUMN active_user_id VARCHAR(100) AS (IF(deleted_at IS NULL, user_id, NULL)) VIRTUAL,
+    ADD UNIQUE INDEX wallets_active_user_id_currency_unique (active_user_id, currency);
+
+CREATE TABLE exchange_rates
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    base_currency CHAR(3) NOT NULL,
+    quote_currency CHAR(3) NOT NULL,
+    rate DECIMAL(24, 12) NOT NULL,
+    effective_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX exchange_rates_pair_index (base_currency, quote_currency, effective_at)
+) ENGINE = InnoDB;
+
+CREATE TABLE wallet_holds
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    wallet_id VARCHAR(100) NOT NULL,
+    amount BIGINT NOT NULL,
+    captured_amount BIGINT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX wallet_holds_wallet_id_status_index (wallet_id, status, expires_at),
+    FOREIGN KEY (wallet_id) REFERENCES wallets (id)
+) ENGINE = InnoDB;
+
+CREATE TABLE wallet_tiers
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    min_balance BIGINT NOT NULL,
+    max_balance BIGINT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE INDEX wallet_tiers_name_unique (name)
+) ENGINE = InnoDB;
+
+-- pengganti scope BrokeWalletBalance dan SultanWalletBalance
+INSERT INTO wallet_tiers (name, min_balance, max_balance)
+VALUES ('broke', 0, 0),
+       ('regular', 1, 5000),
+       ('sultan', 5001, NULL);
+
+CREATE TABLE wallet_tier_changes
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    wallet_id VARCHAR(100) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    from_tier VARCHAR(100) NOT NULL,
+    to_tier VARCHAR(100) NOT NULL,
+    balance BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX wallet_tier_changes_created_at_index (created_at)
+) ENGINE = InnoDB;
+
+CREATE TABLE scheduled_transfers
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    from_wallet_id VARCHAR(100) NOT NULL,
+    to_wallet_id VARCHAR(100) NOT NULL,
+    amount BIGINT NOT NULL,
+    schedule VARCHAR(100) NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    last_run_at TIMESTAMP NULL,
+    last_error VARCHAR(255) NOT NULL DEFAULT '',
+    claimed_by VARCHAR(100) NOT NULL DEFAULT '',
+    claimed_until TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX scheduled_transfers_due_index (status, next_run_at)
+) ENGINE = InnoDB;
+
+CREATE TABLE scheduled_transfer_runs
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    scheduled_transfer_id BIGINT NOT NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    reference_id VARCHAR(100) NOT NULL DEFAULT '',
+    failure_reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE INDEX scheduled_transfer_runs_unique (scheduled_transfer_id, scheduled_at),
+    FOREIGN KEY (scheduled_transfer_id) REFERENCES scheduled_transfers (id)
+) ENGINE = InnoDB;
+
+ALTER TABLE wallets
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active';
+
+CREATE TABLE wallet_status_changes
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    wallet_id VARCHAR(100) NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX wallet_status_changes_wallet_id_index (wallet_id),
+    FOREIGN KEY (wallet_id) REFERENCES wallets (id)
+) ENGINE = InnoDB;
+
+ALTER TABLE todos
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'open' AFTER version,
+    ADD COLUMN completed_at TIMESTAMP NULL AFTER status;
+
+CREATE TABLE todo_status_changes
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    todo_id BIGINT NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    actor_id VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX todo_status_changes_todo_id_index (todo_id),
+    FOREIGN KEY (todo_id) REFERENCES todos (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
+
+ALTER TABLE users
+    ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '';
+
+ALTER TABLE todos
+    ADD COLUMN due_at TIMESTAMP NULL AFTER completed_at,
+    ADD COLUMN priority INT NOT NULL DEFAULT 0 AFTER due_at,
+    ADD INDEX todos_user_id_due_at_index (user_id, due_at);
+
+CREATE TABLE todo_reminders
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    todo_id BIGINT NOT NULL,
+    due_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE INDEX todo_reminders_unique (todo_id, due_at),
+    FOREIGN KEY (todo_id) REFERENCES todos (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
+
+CREATE TABLE tags
+(
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    user_id VARCHAR(100) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE INDEX tags_user_id_name_unique (user_id, name)
+) ENGINE = InnoDB;
+
+CREATE TABLE todo_tags
+(
+    todo_id BIGINT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    PRIMARY KEY (todo_id, tag_id),
+    INDEX todo_tags_tag_id_index (tag_id),
+    FOREIGN KEY (todo_id) REFERENCES todos (id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
+
+ALTER TABLE todos
+    ADD COLUMN parent_id BIGINT NULL AFTER user_id,
+    ADD INDEX todos_parent_id_index (parent_id),
+    ADD FOREIGN KEY (parent_id) REFERENCES todos (id) ON DELETE CASCADE;
+
+-- collation binary supaya urutan rank leksikografis
+ALTER TABLE todos
+    ADD COLUMN rank_key VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin NOT NULL DEFAULT '' AFTER priority,
+    ADD INDEX todos_user_id_rank_key_index (user_id, rank_key);
+
+ALTER TABLE todos
+    ADD COLUMN recurrence VARCHAR(255) NOT NULL DEFAULT '' AFTER rank_key,
+    ADD COLUMN recurrence_parent_id BIGINT NULL AFTER recurrence,
+    ADD UNIQUE INDEX todos_recurrence_parent_id_due_at_unique (recurrence_parent_id, due_at),
+    ADD FOREIGN KEY (recurrence_parent_id) REFERENCES todos (id) ON DELETE SET NULL;
+
+CREATE TABLE todo_collaborators
+(
+    todo_id BIGINT NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (todo_id, user_id),
+    INDEX todo_collaborators_user_id_index (user_id),
+    FOREIGN KEY (todo_id) REFERENCES todos (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE = InnoDB;
+
+ALTER TABLE todos
+    ADD FULLTEXT INDEX todos_title_description_fulltext (title, description);
+
+-- struktur sama seperti hasil AutoMigrate model GuestBook, ditambah index FULLTEXT untuk pencarian
+CREATE TABLE guest_books
+(
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    name LONGTEXT NULL,
+    email LONGTEXT NULL,
+    message LONGTEXT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_guest_books_deleted_at (deleted_at),
+    FULLTEXT INDEX guest_books_message_fulltext (message)
+) ENGINE = InnoDB;
+
+-- balance awal wallet lama belum punya entry ledger, selisih balance dengan total ledger dicatat sebagai entry opening
+-- supaya RebuildBalance tidak mengubah balance wallet yang sudah ada
+INSERT INTO wallet_entries (wallet_id, amount, balance_after, currency, reference_type, reference_id, created_at)
+SELECT wallets.id,
+       wallets.balance - coalesce(ledger.total, 0),
+       wallets.balance - coalesce(ledger.total, 0),
+       wallets.currency,
+       'opening',
+       wallets.id,
+       wallets.created_at
+FROM wallets
+         LEFT JOIN (SELECT wallet_id, sum(amount) AS total FROM wallet_entries GROUP BY wallet_id) AS ledger
+                   ON ledger.wallet_id = wallets.id
+WHERE wallets.balance <> coalesce(ledger.total, 0);
+
+-- mata uang hold, transfer terjadwal dan riwayat tier mengikuti wallet, amount dibaca sebagai money.Money
+ALTER TABLE wallet_holds
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR' AFTER captured_amount;
+
+UPDATE wallet_holds
+    JOIN wallets ON wallets.id = wallet_holds.wallet_id
+SET wallet_holds.currency = wallets.currency;
+
+ALTER TABLE scheduled_transfers
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR' AFTER amount;
+
+UPDATE scheduled_transfers
+    JOIN wallets ON wallets.id = scheduled_transfers.from_wallet_id
+SET scheduled_transfers.currency = wallets.currency;
+
+ALTER TABLE wallet_tier_changes
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR' AFTER balance;
+
+UPDATE wallet_tier_changes
+    JOIN wallets ON wallets.id = wallet_tier_changes.wallet_id
+SET wallet_tier_changes.currency = wallets.currency;
@@ -0,0 +1,176 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// format ciphertext: enc:v1:<key id>:<data key terenkripsi>:<nonce+ciphertext>
+const prefix = "enc:v1:"
+
+var (
+	ErrNoKeyRing     = errors.New("key ring belum diset")
+	ErrUnknownKey    = errors.New("key id tidak ada di key ring")
+	ErrMalformedData = errors.New("format ciphertext tidak valid")
+)
+
+// key ring berisi master key (KEK) per key id
+// Primary dipakai untuk enkripsi, key lain tetap disimpan untuk dekripsi data lama
+type KeyRing struct {
+	Primary string
+	Keys    map[string][]byte
+	// key HMAC untuk blind index, sengaja dipisah dari key enkripsi
+	IndexKey []byte
+}
+
+var (
+	mutex   sync.RWMutex
+	keyRing *KeyRing
+)
+
+// set key ring global yang dipakai serializer
+// tanpa key ring kolom terenkripsi tidak bisa ditulis, data lama yang masih plaintext tetap terbaca
+func SetKeyRing(ring *KeyRing) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	keyRing = ring
+}
+
+func currentKeyRing() *KeyRing {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return keyRing
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// ambil key id dari ciphertext, kosong jika value masih plaintext
+func KeyId(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	return parts[0]
+}
+
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformedData
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// envelope encryption, setiap value dienkripsi dengan data key acak
+// lalu data key dienkripsi dengan master key primary
+func (r *KeyRing) Encrypt(plaintext string) (string, error) {
+	kek, ok := r.Keys[r.Primary]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, r.Primary)
+	}
+
+	dek := make([]byte, 32)
+	_, err := rand.Read(dek)
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(kek, dek)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawStdEncoding
+	return prefix + r.Primary + ":" + encoding.EncodeToString(wrappedKey) + ":" + encoding.EncodeToString(ciphertext), nil
+}
+
+func (r *KeyRing) Decrypt(value string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if !IsEncrypted(value) || len(parts) != 3 {
+		return "", ErrMalformedData
+	}
+
+	kek, ok := r.Keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, parts[0])
+	}
+
+	encoding := base64.RawStdEncoding
+	wrappedKey, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformedData
+	}
+	ciphertext, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformedData
+	}
+
+	dek, err := open(kek, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dek, ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// blind index untuk pencarian equality di kolom terenkripsi
+// contoh: db.Where("address_bidx = ?", encryption.BlindIndex("Jalan A"))
+func BlindIndex(value string) string {
+	ring := currentKeyRing()
+	if ring == nil || len(ring.IndexKey) == 0 || value == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, ring.IndexKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
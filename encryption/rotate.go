@@ -0,0 +1,83 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// job rotasi key, enkripsi ulang kolom yang masih pakai key lama (atau masih plaintext)
+// dengan key primary, diproses per batch berdasarkan primary key
+func ReEncrypt(ctx context.Context, db *gorm.DB, table string, primaryKey string, columns []string, batchSize int) (int64, error) {
+	ring := currentKeyRing()
+	if ring == nil {
+		return 0, ErrNoKeyRing
+	}
+
+	var updated int64
+	var lastId interface{}
+	for {
+		query := db.WithContext(ctx).Table(table).Select(append([]string{primaryKey}, columns...)).Order(primaryKey + " asc").Limit(batchSize)
+		if lastId != nil {
+			query = query.Where(primaryKey+" > ?", lastId)
+		}
+
+		var rows []map[string]interface{}
+		err := query.Find(&rows).Error
+		if err != nil {
+			return updated, err
+		}
+		if len(rows) == 0 {
+			return updated, nil
+		}
+
+		for _, row := range rows {
+			values := map[string]interface{}{}
+			for _, column := range columns {
+				value := toString(row[column])
+				if value == "" || KeyId(value) == ring.Primary {
+					continue
+				}
+
+				if IsEncrypted(value) {
+					value, err = ring.Decrypt(value)
+					if err != nil {
+						return updated, fmt.Errorf("decrypt %s.%s %v: %w", table, column, row[primaryKey], err)
+					}
+				}
+
+				values[column], err = ring.Encrypt(value)
+				if err != nil {
+					return updated, err
+				}
+			}
+
+			if len(values) > 0 {
+				err = db.WithContext(ctx).Table(table).Where(primaryKey+" = ?", row[primaryKey]).UpdateColumns(values).Error
+				if err != nil {
+					return updated, err
+				}
+				updated++
+			}
+		}
+
+		lastId = rows[len(rows)-1][primaryKey]
+		if id, ok := lastId.([]byte); ok {
+			lastId = string(id)
+		}
+	}
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
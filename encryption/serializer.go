@@ -0,0 +1,116 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var ErrMapUpdate = errors.New("kolom terenkripsi harus disimpan lewat struct, map tidak melewati serializer dan hook blind index")
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// serializer GORM untuk kolom string terenkripsi, pakai tag gorm:"serializer:encrypted"
+// value tanpa prefix dianggap plaintext lama sehingga data yang belum dimigrasi tetap terbaca
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("tidak bisa decrypt value %#v", dbValue)
+	}
+
+	if IsEncrypted(value) {
+		ring := currentKeyRing()
+		if ring == nil {
+			return ErrNoKeyRing
+		}
+
+		plaintext, err := ring.Decrypt(value)
+		if err != nil {
+			return err
+		}
+		value = plaintext
+	}
+
+	return field.Set(ctx, dst, value)
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("serializer encrypted hanya untuk string, dapat %T", fieldValue)
+	}
+
+	// tanpa key ring data akan tersimpan sebagai plaintext, jadi ditolak
+	ring := currentKeyRing()
+	if ring == nil {
+		return nil, ErrNoKeyRing
+	}
+	if value == "" {
+		return value, nil
+	}
+
+	return ring.Encrypt(value)
+}
+
+// plugin yang menolak create dan update dengan map ke kolom terenkripsi, contoh:
+//
+//	db.Model(&user).Update("first_name", "Budi")
+//
+// harus diganti dengan update lewat struct, daftarkan dengan db.Use(encryption.Plugin{})
+// query dengan Table() tanpa Model() tidak diperiksa, dipakai misalnya oleh ReEncrypt
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "encryption"
+}
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	err := db.Callback().Create().Before("gorm:create").Register("encryption:reject_map", rejectMap)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register("encryption:reject_map", rejectMap)
+}
+
+func rejectMap(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	var values []map[string]interface{}
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		values = append(values, dest)
+	case *map[string]interface{}:
+		values = append(values, *dest)
+	case []map[string]interface{}:
+		values = dest
+	}
+
+	for _, value := range values {
+		for name := range value {
+			field := db.Statement.Schema.LookUpField(name)
+			if field == nil {
+				continue
+			}
+			if _, ok := field.Serializer.(Serializer); ok {
+				db.AddError(fmt.Errorf("%w: %s.%s", ErrMapUpdate, db.Statement.Schema.Table, field.DBName))
+				return
+			}
+		}
+	}
+}
@@ -1,9 +1,15 @@
 package model
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/dickidarmawansaputra/belajar-gorm/encryption"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"github.com/dickidarmawansaputra/belajar-gorm/optimisticlock"
+	"github.com/dickidarmawansaputra/belajar-gorm/rank"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // check convention di GORM
@@ -14,13 +20,21 @@ type User struct {
 	Name      Name      `gorm:"embedded"`
 	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
 	UpdatedAt time.Time `gorm:"column:created_at;autoCreateTime;autoUpdateTime"`
+	// user yang dinonaktifkan di soft delete
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at"`
+	// blind index first_name, dipakai untuk pencarian karna first_name terenkripsi
+	FirstNameIndex string `gorm:"column:first_name_bidx"`
+	// zona waktu user untuk menghitung batas hari, contoh Asia/Jakarta
+	TimeZone string `gorm:"column:time_zone"`
 	// contoh penerapan field permission
 	// lebih lengkap di file pdfnya
 	// seperti tanda <-: -  dll
 	Information  string    `gorm:"-"`
-	Wallet       Wallet    `gorm:"foreignKey:user_id;references:id"`
 	Addresses    []Address `gorm:"foreignKey:user_id;references:id"`
 	LikeProducts []Product `gorm:"many2many:user_like_product;foreignKey:id;joinForeignKey:user_id;references:id;joinReferences:product_id"`
+	// satu user bisa punya satu wallet per mata uang, jadi tidak ada lagi relasi has one ke wallet
+	// untuk wallet mata uang tertentu pakai Preload("Wallets", "currency = ?", currency)
+	Wallets []Wallet `gorm:"foreignKey:user_id;references:id"`
 }
 
 // jika ingin merubah nama table
@@ -28,6 +42,20 @@ func (u *User) TableName() string {
 	return "users"
 }
 
+func (u *User) BeforeSave(db *gorm.DB) error {
+	u.FirstNameIndex = encryption.BlindIndex(u.Name.FirstName)
+	return nil
+}
+
+// zona waktu user, time.Local jika kosong atau tidak dikenal
+func (u *User) Location() *time.Location {
+	location, err := time.LoadLocation(u.TimeZone)
+	if u.TimeZone == "" || err != nil {
+		return time.Local
+	}
+	return location
+}
+
 func (u *User) BeforeCreate(db *gorm.DB) error {
 	if u.Id == "" {
 		u.Id = "user-" + time.Now().Format("20060102150405")
@@ -35,10 +63,11 @@ func (u *User) BeforeCreate(db *gorm.DB) error {
 	return nil
 }
 
+// nama user dienkripsi di database, lihat package encryption
 type Name struct {
-	FirstName  string `gorm:"column:first_name"`
-	MiddleName string `gorm:"column:middle_name"`
-	LastName   string `gorm:"column:last_name"`
+	FirstName  string `gorm:"column:first_name;serializer:encrypted"`
+	MiddleName string `gorm:"column:middle_name;serializer:encrypted"`
+	LastName   string `gorm:"column:last_name;serializer:encrypted"`
 }
 
 type UserLog struct {
@@ -62,6 +91,28 @@ type Todo struct {
 	UserId      string `gorm:"column:user_id"`
 	Title       string `gorm:"column:title"`
 	Description string `gorm:"column:description"`
+	// optimistic locking, Save dan Updates gagal jika todo sudah diubah proses lain
+	Version optimisticlock.Version `gorm:"column:version"`
+	// ubah status lewat TodoService.Transition supaya riwayatnya tercatat
+	Status      string     `gorm:"column:status"`
+	CompletedAt *time.Time `gorm:"column:completed_at"`
+	// tenggat dan prioritas, lihat scope Overdue, DueWithin, ByPriority dan Today
+	DueAt    *time.Time `gorm:"column:due_at"`
+	Priority int        `gorm:"column:priority"`
+	// dikonfigurasi seperti User.LikeProducts
+	Tags []Tag `gorm:"many2many:todo_tags;foreignKey:id;joinForeignKey:todo_id;references:id;joinReferences:tag_id"`
+	// todo induk, nil untuk todo paling atas
+	ParentID *uint  `gorm:"column:parent_id"`
+	Subtasks []Todo `gorm:"foreignKey:parent_id;references:id"`
+	// urutan manual todo milik user, lihat package rank
+	Rank string `gorm:"column:rank_key"`
+	// aturan pengulangan (RRULE) disimpan di todo pertama seri
+	// occurrence berikutnya menunjuk ke todo pertama lewat RecurrenceParentID
+	Recurrence         string `gorm:"column:recurrence"`
+	RecurrenceParentID *uint  `gorm:"column:recurrence_parent_id"`
+	Occurrences        []Todo `gorm:"foreignKey:recurrence_parent_id;references:id"`
+	// user lain yang diberi akses ke todo ini
+	Collaborators []TodoCollaborator `gorm:"foreignKey:todo_id;references:id"`
 	// CreatedAt   time.Time      `gorm:"column:created_at;autoCreateTime"`
 	// UpdatedAt   time.Time      `gorm:"column:created_at;autoCreateTime;autoUpdateTime"`
 	// DeletedAt   gorm.DeletedAt `gorm:"column:deleted_at"`
@@ -71,13 +122,105 @@ func (u *Todo) TableName() string {
 	return "todos"
 }
 
+func (u *Todo) BeforeCreate(db *gorm.DB) error {
+	if u.Status == "" {
+		u.Status = "open"
+	}
+
+	// todo baru ditaruh di urutan paling bawah
+	if u.Rank == "" {
+		// rank terakhir disimpan di statement supaya todo dalam satu batch create tidak dapat rank yang sama
+		// semua todo dalam batch memanggil hook dengan db yang sama
+		key := fmt.Sprintf("%p:todo:last_rank:%s", db.Statement, u.UserId)
+		last, ok := db.Statement.Settings.Load(key)
+		if !ok {
+			// semua todo user di lock seperti saat memindah urutan, create lain untuk user yang sama
+			// menunggu sampai transaction ini selesai lalu membaca rank yang baru
+			var ranks []string
+			err := db.Session(&gorm.Session{NewDB: true}).Model(&Todo{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ?", u.UserId).Pluck("rank_key", &ranks).Error
+			if err != nil {
+				return err
+			}
+
+			latest := ""
+			for _, r := range ranks {
+				if r > latest {
+					latest = r
+				}
+			}
+			last = latest
+		}
+		u.Rank = rank.After(last.(string))
+		db.Statement.Settings.Store(key, u.Rank)
+	}
+	return nil
+}
+
+// tag milik user, nama tag unik per user
+type Tag struct {
+	ID        int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	UserId    string    `gorm:"column:user_id"`
+	Name      string    `gorm:"column:name"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoCreateTime;autoUpdateTime"`
+	Todos     []Todo    `gorm:"many2many:todo_tags;foreignKey:id;joinForeignKey:tag_id;references:id;joinReferences:todo_id"`
+}
+
+func (u *Tag) TableName() string {
+	return "tags"
+}
+
+// user yang diberi akses ke todo milik user lain, role viewer atau editor
+type TodoCollaborator struct {
+	TodoId    uint      `gorm:"column:todo_id;primaryKey"`
+	UserId    string    `gorm:"column:user_id;primaryKey"`
+	Role      string    `gorm:"column:role"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoCreateTime;autoUpdateTime"`
+	User      *User     `gorm:"foreignKey:user_id;references:id"`
+}
+
+func (u *TodoCollaborator) TableName() string {
+	return "todo_collaborators"
+}
+
+// reminder yang sudah dikirim, satu reminder per todo per due_at
+type TodoReminder struct {
+	ID        int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	TodoId    uint      `gorm:"column:todo_id"`
+	DueAt     time.Time `gorm:"column:due_at"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+}
+
+func (u *TodoReminder) TableName() string {
+	return "todo_reminders"
+}
+
+// riwayat perubahan status todo beserta user yang mengubahnya
+type TodoStatusChange struct {
+	ID         int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	TodoId     uint      `gorm:"column:todo_id"`
+	FromStatus string    `gorm:"column:from_status"`
+	ToStatus   string    `gorm:"column:to_status"`
+	ActorId    string    `gorm:"column:actor_id"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+}
+
+func (u *TodoStatusChange) TableName() string {
+	return "todo_status_changes"
+}
+
 type Wallet struct {
-	Id        string         `gorm:"column:id"`
-	UserId    string         `gorm:"column:user_id"`
-	Balance   int64          `gorm:"column:balance"`
-	CreatedAt time.Time      `gorm:"column:created_at;autoCreateTime"`
-	UpdatedAt time.Time      `gorm:"column:created_at;autoCreateTime;autoUpdateTime"`
-	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at"`
+	Id        string                 `gorm:"column:id"`
+	UserId    string                 `gorm:"column:user_id"`
+	Balance   money.Money            `gorm:"column:balance"`
+	Currency  string                 `gorm:"column:currency"`
+	Status    string                 `gorm:"column:status"`
+	CreatedAt time.Time              `gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt time.Time              `gorm:"column:created_at;autoCreateTime;autoUpdateTime"`
+	DeletedAt gorm.DeletedAt         `gorm:"column:deleted_at"`
+	Version   optimisticlock.Version `gorm:"column:version"`
 	// jika terjadi cyclic gunakan pointer
 	// belongs to juga bisa jadi has one
 	User *User `gorm:"foreignKey:user_id;references:id"`
@@ -87,30 +230,282 @@ func (u *Wallet) TableName() string {
 	return "wallets"
 }
 
+func (u *Wallet) BeforeCreate(db *gorm.DB) error {
+	if u.Status == "" {
+		u.Status = "active"
+	}
+	return nil
+}
+
+func (u *Wallet) BeforeSave(db *gorm.DB) error {
+	return syncCurrency(&u.Currency, &u.Balance)
+}
+
+// wallet yang dibuat dengan balance awal dicatat sebagai entry opening
+// supaya balance tetap sama dengan total ledger saat dihitung ulang
+func (u *Wallet) AfterCreate(db *gorm.DB) error {
+	if u.Balance.Amount == 0 {
+		return nil
+	}
+	return db.Create(&WalletEntry{
+		WalletId:      u.Id,
+		Amount:        u.Balance,
+		BalanceAfter:  u.Balance,
+		ReferenceType: "opening",
+		ReferenceId:   u.Id,
+	}).Error
+}
+
+func (u *Wallet) AfterFind(db *gorm.DB) error {
+	u.Balance.Currency = u.Currency
+	return nil
+}
+
+// ledger wallet, setiap perubahan balance dicatat di sini
+// amount positif untuk credit dan negatif untuk debit
+type WalletEntry struct {
+	ID            int64       `gorm:"column:id;primaryKey;autoIncrement"`
+	WalletId      string      `gorm:"column:wallet_id"`
+	Amount        money.Money `gorm:"column:amount"`
+	BalanceAfter  money.Money `gorm:"column:balance_after"`
+	Currency      string      `gorm:"column:currency"`
+	ReferenceType string      `gorm:"column:reference_type"`
+	ReferenceId   string      `gorm:"column:reference_id"`
+	CreatedAt     time.Time   `gorm:"column:created_at;autoCreateTime;<-:create"`
+}
+
+func (u *WalletEntry) TableName() string {
+	return "wallet_entries"
+}
+
+func (u *WalletEntry) BeforeSave(db *gorm.DB) error {
+	return syncCurrency(&u.Currency, &u.Amount, &u.BalanceAfter)
+}
+
+func (u *WalletEntry) AfterFind(db *gorm.DB) error {
+	u.Amount.Currency = u.Currency
+	u.BalanceAfter.Currency = u.Currency
+	return nil
+}
+
+// tier wallet berdasarkan balance, MaxBalance nil berarti tanpa batas atas
+type WalletTier struct {
+	ID         int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	Name       string    `gorm:"column:name"`
+	MinBalance int64     `gorm:"column:min_balance"`
+	MaxBalance *int64    `gorm:"column:max_balance"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+	UpdatedAt  time.Time `gorm:"column:updated_at;autoCreateTime;autoUpdateTime"`
+}
+
+func (u *WalletTier) TableName() string {
+	return "wallet_tiers"
+}
+
+// riwayat perpindahan tier wallet
+type WalletTierChange struct {
+	ID        int64       `gorm:"column:id;primaryKey;autoIncrement"`
+	WalletId  string      `gorm:"column:wallet_id"`
+	UserId    string      `gorm:"column:user_id"`
+	FromTier  string      `gorm:"column:from_tier"`
+	ToTier    string      `gorm:"column:to_tier"`
+	Balance   money.Money `gorm:"column:balance"`
+	Currency  string      `gorm:"column:currency"`
+	CreatedAt time.Time   `gorm:"column:created_at;autoCreateTime;<-:create"`
+}
+
+func (u *WalletTierChange) TableName() string {
+	return "wallet_tier_changes"
+}
+
+func (u *WalletTierChange) BeforeSave(db *gorm.DB) error {
+	return syncCurrency(&u.Currency, &u.Balance)
+}
+
+func (u *WalletTierChange) AfterFind(db *gorm.DB) error {
+	u.Balance.Currency = u.Currency
+	return nil
+}
+
+// transfer terjadwal, Schedule berisi ekspresi jadwal seperti monthly:1
+type ScheduledTransfer struct {
+	ID           int64       `gorm:"column:id;primaryKey;autoIncrement"`
+	FromWalletId string      `gorm:"column:from_wallet_id"`
+	ToWalletId   string      `gorm:"column:to_wallet_id"`
+	Amount       money.Money `gorm:"column:amount"`
+	Currency     string      `gorm:"column:currency"`
+	Schedule     string      `gorm:"column:schedule"`
+	NextRunAt    time.Time   `gorm:"column:next_run_at"`
+	Status       string      `gorm:"column:status"`
+	LastRunAt    *time.Time  `gorm:"column:last_run_at"`
+	LastError    string      `gorm:"column:last_error"`
+	ClaimedBy    string      `gorm:"column:claimed_by"`
+	ClaimedUntil *time.Time  `gorm:"column:claimed_until"`
+	CreatedAt    time.Time   `gorm:"column:created_at;autoCreateTime;<-:create"`
+	UpdatedAt    time.Time   `gorm:"column:updated_at;autoCreateTime;autoUpdateTime"`
+}
+
+func (u *ScheduledTransfer) TableName() string {
+	return "scheduled_transfers"
+}
+
+func (u *ScheduledTransfer) BeforeSave(db *gorm.DB) error {
+	return syncCurrency(&u.Currency, &u.Amount)
+}
+
+func (u *ScheduledTransfer) AfterFind(db *gorm.DB) error {
+	u.Amount.Currency = u.Currency
+	return nil
+}
+
+// hasil setiap eksekusi transfer terjadwal
+type ScheduledTransferRun struct {
+	ID                  int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	ScheduledTransferId int64     `gorm:"column:scheduled_transfer_id"`
+	ScheduledAt         time.Time `gorm:"column:scheduled_at"`
+	Status              string    `gorm:"column:status"`
+	ReferenceId         string    `gorm:"column:reference_id"`
+	FailureReason       string    `gorm:"column:failure_reason"`
+	CreatedAt           time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+}
+
+func (u *ScheduledTransferRun) TableName() string {
+	return "scheduled_transfer_runs"
+}
+
+// riwayat perubahan status wallet (freeze, unfreeze, close)
+type WalletStatusChange struct {
+	ID         int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	WalletId   string    `gorm:"column:wallet_id"`
+	FromStatus string    `gorm:"column:from_status"`
+	ToStatus   string    `gorm:"column:to_status"`
+	Reason     string    `gorm:"column:reason"`
+	Actor      string    `gorm:"column:actor"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+}
+
+func (u *WalletStatusChange) TableName() string {
+	return "wallet_status_changes"
+}
+
+// dana wallet yang ditahan sebelum pembelian dikonfirmasi
+type WalletHold struct {
+	ID             int64       `gorm:"column:id;primaryKey;autoIncrement"`
+	WalletId       string      `gorm:"column:wallet_id"`
+	Amount         money.Money `gorm:"column:amount"`
+	CapturedAmount money.Money `gorm:"column:captured_amount"`
+	Currency       string      `gorm:"column:currency"`
+	Status         string      `gorm:"column:status"`
+	ExpiresAt      time.Time   `gorm:"column:expires_at"`
+	CreatedAt      time.Time   `gorm:"column:created_at;autoCreateTime;<-:create"`
+	UpdatedAt      time.Time   `gorm:"column:updated_at;autoCreateTime;autoUpdateTime"`
+}
+
+func (u *WalletHold) TableName() string {
+	return "wallet_holds"
+}
+
+func (u *WalletHold) BeforeSave(db *gorm.DB) error {
+	return syncCurrency(&u.Currency, &u.Amount, &u.CapturedAmount)
+}
+
+func (u *WalletHold) AfterFind(db *gorm.DB) error {
+	u.Amount.Currency = u.Currency
+	u.CapturedAmount.Currency = u.Currency
+	return nil
+}
+
+// menyimpan hasil operasi per idempotency key supaya request yang diulang tidak dijalankan dua kali
+type IdempotencyKey struct {
+	Key         string    `gorm:"column:idempotency_key;primaryKey"`
+	RequestHash string    `gorm:"column:request_hash"`
+	Status      string    `gorm:"column:status"`
+	Response    string    `gorm:"column:response"`
+	ExpiresAt   time.Time `gorm:"column:expires_at"`
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+	UpdatedAt   time.Time `gorm:"column:updated_at;autoCreateTime;autoUpdateTime"`
+}
+
+func (u *IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
 type Address struct {
 	gorm.Model
-	UserId  string `gorm:"column:user_id"`
-	Address string `gorm:"column:address"`
-	User    User   `gorm:"foreignKey:user_id;references:id"`
+	UserId       string `gorm:"column:user_id"`
+	Address      string `gorm:"column:address;serializer:encrypted"`
+	AddressIndex string `gorm:"column:address_bidx"`
+	User         User   `gorm:"foreignKey:user_id;references:id"`
 }
 
 func (u *Address) TableName() string {
 	return "addresses"
 }
 
+func (u *Address) BeforeSave(db *gorm.DB) error {
+	u.AddressIndex = encryption.BlindIndex(u.Address)
+	return nil
+}
+
 type Product struct {
-	ID           string    `gorm:"column:id;primaryKey"`
-	Name         string    `gorm:"column:name"`
-	Price        int64     `gorm:"column:price"`
-	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime"`
-	UpdatedAt    time.Time `gorm:"column:created_at;autoCreateTime;autoUpdateTime"`
-	LikedByUsers []User    `gorm:"many2many:user_like_product;foreignKey:id;joinForeignKey:product_id;references:id;joinReferences:user_id"`
+	ID           string      `gorm:"column:id;primaryKey"`
+	Name         string      `gorm:"column:name"`
+	Price        money.Money `gorm:"column:price"`
+	Currency     string      `gorm:"column:currency"`
+	CreatedAt    time.Time   `gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt    time.Time   `gorm:"column:created_at;autoCreateTime;autoUpdateTime"`
+	LikedByUsers []User      `gorm:"many2many:user_like_product;foreignKey:id;joinForeignKey:product_id;references:id;joinReferences:user_id"`
 }
 
 func (u *Product) TableName() string {
 	return "products"
 }
 
+func (u *Product) BeforeSave(db *gorm.DB) error {
+	return syncCurrency(&u.Currency, &u.Price)
+}
+
+func (u *Product) AfterFind(db *gorm.DB) error {
+	u.Price.Currency = u.Currency
+	return nil
+}
+
+// kolom currency dan mata uang di field Money harus sama sebelum disimpan
+// yang kosong diisi dari yang lain, jika semuanya kosong pakai mata uang default
+func syncCurrency(currency *string, values ...*money.Money) error {
+	for _, value := range values {
+		if *currency == "" {
+			*currency = value.Currency
+		}
+	}
+	if *currency == "" {
+		*currency = money.DefaultCurrency
+	}
+
+	for _, value := range values {
+		if value.Currency != "" && value.Currency != *currency {
+			return fmt.Errorf("%w: %s dan %s", money.ErrCurrencyMismatch, value.Currency, *currency)
+		}
+		value.Currency = *currency
+	}
+	return nil
+}
+
+// kurs mata uang, 1 BaseCurrency = Rate QuoteCurrency
+// rate disimpan sebagai decimal string supaya tidak kehilangan presisi
+type ExchangeRate struct {
+	ID            int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	BaseCurrency  string    `gorm:"column:base_currency"`
+	QuoteCurrency string    `gorm:"column:quote_currency"`
+	Rate          string    `gorm:"column:rate"`
+	EffectiveAt   time.Time `gorm:"column:effective_at"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime;<-:create"`
+}
+
+func (u *ExchangeRate) TableName() string {
+	return "exchange_rates"
+}
+
 type GuestBook struct {
 	gorm.Model
 	Name    string `gorm:"column:name"`
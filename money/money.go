@@ -0,0 +1,202 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// mata uang default untuk data lama yang belum punya kolom currency
+const DefaultCurrency = "IDR"
+
+var (
+	ErrCurrencyMismatch = errors.New("tidak bisa menghitung dua mata uang yang berbeda")
+	ErrUnknownCurrency  = errors.New("mata uang tidak dikenal")
+)
+
+// jumlah digit minor unit per kode ISO 4217
+// IDR dicatat tanpa sen karena saldo lama di kolom balance sudah dalam rupiah penuh
+var minorUnits = map[string]int{
+	"IDR": 0,
+	"USD": 2,
+	"EUR": 2,
+	"SGD": 2,
+	"MYR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+}
+
+func MinorUnits(currency string) (int, error) {
+	digits, ok := minorUnits[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCurrency, currency)
+	}
+	return digits, nil
+}
+
+// nilai uang dalam minor unit (contoh sen) beserta kode mata uangnya
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// di database Money disimpan sebagai amount saja, mata uangnya ada di kolom currency milik model
+// model yang memakai Money harus mengisi Currency dari kolom tersebut setelah dibaca
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+func (m *Money) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case int64:
+		m.Amount = value
+	case []byte:
+		return m.Scan(string(value))
+	case string:
+		amount, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("money: tidak bisa membaca amount %q: %w", value, err)
+		}
+		m.Amount = amount
+	default:
+		return fmt.Errorf("money: tipe amount %T tidak didukung", value)
+	}
+	return nil
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s dan %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(other.Negate())
+}
+
+func (m Money) Negate() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Compare(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, fmt.Errorf("%w: %s dan %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// contoh: USD 15.00, IDR 1500
+func (m Money) String() string {
+	digits, err := MinorUnits(m.Currency)
+	if err != nil || digits == 0 {
+		return fmt.Sprintf("%s %d", m.Currency, m.Amount)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := int64(1)
+	for i := 0; i < digits; i++ {
+		scale *= 10
+	}
+	return fmt.Sprintf("%s %s%d.%0*d", m.Currency, sign, amount/scale, digits, amount%scale)
+}
+
+type RoundingMode int
+
+const (
+	// .5 dibulatkan menjauhi nol
+	RoundHalfUp RoundingMode = iota
+	// .5 dibulatkan ke angka genap terdekat (banker's rounding)
+	RoundHalfEven
+	// selalu dibulatkan mendekati nol
+	RoundDown
+	// selalu dibulatkan menjauhi nol
+	RoundUp
+)
+
+// konversi ke mata uang lain dengan rate (1 unit mata uang asal = rate unit mata uang tujuan)
+// pembulatan ke minor unit tujuan harus dipilih secara eksplisit
+func (m Money) Convert(currency string, rate *big.Rat, mode RoundingMode) (Money, error) {
+	currency = strings.ToUpper(currency)
+	fromDigits, err := MinorUnits(m.Currency)
+	if err != nil {
+		return Money{}, err
+	}
+	toDigits, err := MinorUnits(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	value := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), rate)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(toDigits-fromDigits))), nil)
+	if toDigits >= fromDigits {
+		value.Mul(value, new(big.Rat).SetInt(scale))
+	} else {
+		value.Quo(value, new(big.Rat).SetInt(scale))
+	}
+
+	return Money{Amount: round(value, mode), Currency: currency}, nil
+}
+
+func round(value *big.Rat, mode RoundingMode) int64 {
+	negative := value.Sign() < 0
+	absolute := new(big.Rat).Abs(value)
+
+	quotient, remainder := new(big.Int).QuoRem(absolute.Num(), absolute.Denom(), new(big.Int))
+	if remainder.Sign() != 0 {
+		// bandingkan sisa pembagian dengan setengah
+		half := new(big.Int).Mul(remainder, big.NewInt(2)).Cmp(absolute.Denom())
+		switch mode {
+		case RoundUp:
+			quotient.Add(quotient, big.NewInt(1))
+		case RoundHalfUp:
+			if half >= 0 {
+				quotient.Add(quotient, big.NewInt(1))
+			}
+		case RoundHalfEven:
+			if half > 0 || (half == 0 && quotient.Bit(0) == 1) {
+				quotient.Add(quotient, big.NewInt(1))
+			}
+		}
+	}
+
+	if negative {
+		quotient.Neg(quotient)
+	}
+	return quotient.Int64()
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
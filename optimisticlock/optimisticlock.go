@@ -0,0 +1,153 @@
+package optimisticlock
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// data sudah diubah proses lain sejak terakhir dibaca
+var ErrStaleObject = errors.New("data sudah diubah oleh proses lain, silakan baca ulang")
+
+const versionSetting = "optimisticlock:version"
+
+// kolom version untuk optimistic locking, contoh:
+//
+//	Version optimisticlock.Version `gorm:"column:version"`
+//
+// setiap update akan ditambah WHERE version = ? dan versionnya dinaikkan
+// jangan lupa daftarkan pluginnya dengan db.Use(optimisticlock.Plugin{})
+type Version int64
+
+func (v Version) CreateClauses(field *schema.Field) []clause.Interface {
+	return []clause.Interface{versionCreateClause{Field: field}}
+}
+
+func (v Version) UpdateClauses(field *schema.Field) []clause.Interface {
+	return []clause.Interface{versionUpdateClause{Field: field}}
+}
+
+type versionCreateClause struct {
+	Field *schema.Field
+}
+
+func (v versionCreateClause) Name() string {
+	return ""
+}
+
+func (v versionCreateClause) Build(clause.Builder) {
+}
+
+func (v versionCreateClause) MergeClause(*clause.Clause) {
+}
+
+// data baru selalu mulai dari version 1
+func (v versionCreateClause) ModifyStatement(stmt *gorm.Statement) {
+	if dest, ok := stmt.Dest.(map[string]interface{}); ok {
+		if _, ok := dest[v.Field.DBName]; !ok {
+			dest[v.Field.DBName] = 1
+		}
+		return
+	}
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			if _, isZero := v.Field.ValueOf(stmt.Context, stmt.ReflectValue.Index(i)); isZero {
+				stmt.AddError(v.Field.Set(stmt.Context, stmt.ReflectValue.Index(i), 1))
+			}
+		}
+	case reflect.Struct:
+		if _, isZero := v.Field.ValueOf(stmt.Context, stmt.ReflectValue); isZero && stmt.ReflectValue.CanAddr() {
+			stmt.AddError(v.Field.Set(stmt.Context, stmt.ReflectValue, 1))
+		}
+	}
+}
+
+type versionUpdateClause struct {
+	Field *schema.Field
+}
+
+func (v versionUpdateClause) Name() string {
+	return ""
+}
+
+func (v versionUpdateClause) Build(clause.Builder) {
+}
+
+func (v versionUpdateClause) MergeClause(*clause.Clause) {
+}
+
+func (v versionUpdateClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() != 0 {
+		return
+	}
+
+	var current int64
+	if stmt.ReflectValue.Kind() == reflect.Struct {
+		if value, isZero := v.Field.ValueOf(stmt.Context, stmt.ReflectValue); !isZero {
+			current = reflect.ValueOf(value).Int()
+		}
+	}
+
+	// update lewat map (Update, UpdateColumn, Updates(map)) versionnya dinaikkan di database
+	if dest, ok := stmt.Dest.(map[string]interface{}); ok {
+		dest[v.Field.DBName] = gorm.Expr(stmt.Quote(v.Field.DBName) + " + 1")
+	} else if current != 0 {
+		stmt.SetColumn(v.Field.DBName, current+1, true)
+	}
+
+	// versi yang sedang dipegang tidak diketahui, update tanpa pengecekan
+	if current == 0 {
+		return
+	}
+
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: v.Field.DBName}, Value: current},
+	}})
+	stmt.Settings.Store(versionSetting, current)
+}
+
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "optimisticlock"
+}
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	return db.Callback().Update().After("gorm:update").Register("optimisticlock:check", check)
+}
+
+// jika tidak ada baris yang terupdate berarti version di database sudah berubah
+func check(db *gorm.DB) {
+	value, ok := db.Statement.Settings.LoadAndDelete(versionSetting)
+	if !ok || db.Error != nil || db.DryRun || db.Statement.Schema == nil {
+		return
+	}
+	current := value.(int64)
+
+	field := findVersionField(db.Statement.Schema)
+	if field == nil || db.Statement.ReflectValue.Kind() != reflect.Struct || !db.Statement.ReflectValue.CanAddr() {
+		return
+	}
+
+	if db.RowsAffected == 0 {
+		db.AddError(field.Set(db.Statement.Context, db.Statement.ReflectValue, current))
+		db.AddError(ErrStaleObject)
+		return
+	}
+
+	db.AddError(field.Set(db.Statement.Context, db.Statement.ReflectValue, current+1))
+}
+
+func findVersionField(s *schema.Schema) *schema.Field {
+	for _, field := range s.Fields {
+		if field.FieldType == reflect.TypeOf(Version(0)) {
+			return field
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+// rank adalah string yang diurutkan secara leksikografis (collation binary)
+// rank tidak pernah diakhiri digit terkecil supaya selalu ada ruang di antara dua rank
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+const base = len(digits)
+
+var ErrInvalidRange = errors.New("rank awal harus lebih kecil dari rank akhir")
+
+func digit(key string, i int, fallback int) int {
+	if i >= len(key) {
+		return fallback
+	}
+	return strings.IndexByte(digits, key[i])
+}
+
+func valid(key string) bool {
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return false
+		}
+	}
+	return !strings.HasSuffix(key, digits[:1])
+}
+
+// rank di antara a dan b, a kosong berarti awal list dan b kosong berarti akhir list
+func Between(a string, b string) (string, error) {
+	if !valid(a) || !valid(b) || (b != "" && a >= b) {
+		return "", ErrInvalidRange
+	}
+
+	var key strings.Builder
+	for i := 0; ; i++ {
+		low := digit(a, i, 0)
+		high := base
+		if b != "" {
+			high = digit(b, i, base)
+		}
+
+		if low == high {
+			key.WriteByte(digits[low])
+			continue
+		}
+		if high-low > 1 {
+			key.WriteByte(digits[(low+high)/2])
+			return key.String(), nil
+		}
+
+		// digit bersebelahan, cukup cari rank setelah sisa a karna prefix ini sudah lebih kecil dari b
+		key.WriteByte(digits[low])
+		b = ""
+	}
+}
+
+// rank setelah a, dipakai untuk menambah item di akhir list
+func After(a string) string {
+	key, err := Between(a, "")
+	if err != nil {
+		// a tidak valid, mulai dari tengah
+		key, _ = Between("", "")
+	}
+	return key
+}
+
+// n rank yang tersebar merata dengan panjang sependek mungkin, dipakai saat rebalancing
+func Spread(n int) []string {
+	length := 1
+	capacity := base
+	for capacity <= n {
+		length++
+		capacity *= base
+	}
+
+	step := capacity / (n + 1)
+	keys := make([]string, n)
+	for i := range keys {
+		value := (i + 1) * step
+		key := make([]byte, length)
+		for j := length - 1; j >= 0; j-- {
+			key[j] = digits[value%base]
+			value /= base
+		}
+		keys[i] = strings.TrimRight(string(key), digits[:1])
+	}
+	return keys
+}
@@ -0,0 +1,306 @@
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// subset RRULE RFC 5545 yang didukung:
+//
+//	FREQ=DAILY|WEEKLY|MONTHLY|YEARLY
+//	INTERVAL=n
+//	BYDAY=MO,TU,...     (tanpa angka di depan seperti 1MO atau -1FR)
+//	BYMONTHDAY=15,-1    (negatif dihitung dari akhir bulan)
+//	COUNT=n atau UNTIL=20060102 / 20060102T150405Z
+//
+// contoh setiap hari kerja: FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR
+// contoh setiap tanggal 15: FREQ=MONTHLY;BYMONTHDAY=15
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+var (
+	ErrInvalidRule     = errors.New("rrule tidak valid")
+	ErrUnsupportedRule = errors.New("bagian rrule belum didukung")
+)
+
+// batas jumlah periode yang diperiksa supaya rule yang tidak pernah cocok tidak membuat loop tanpa akhir
+const maxPeriods = 100000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRule, fmt.Sprintf(format, args...))
+}
+
+func Parse(value string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return Rule{}, invalid("rule kosong")
+	}
+
+	for _, part := range strings.Split(value, ";") {
+		key, argument, ok := strings.Cut(part, "=")
+		if !ok || argument == "" {
+			return Rule{}, invalid("%s", part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(argument)
+			if rule.Freq != Daily && rule.Freq != Weekly && rule.Freq != Monthly && rule.Freq != Yearly {
+				return Rule{}, fmt.Errorf("%w: FREQ=%s", ErrUnsupportedRule, argument)
+			}
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(argument)
+			if err != nil || rule.Interval < 1 {
+				return Rule{}, invalid("INTERVAL=%s", argument)
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(argument)
+			if err != nil || rule.Count < 1 {
+				return Rule{}, invalid("COUNT=%s", argument)
+			}
+		case "UNTIL":
+			rule.Until, err = parseUntil(argument)
+			if err != nil {
+				return Rule{}, invalid("UNTIL=%s", argument)
+			}
+		case "BYDAY":
+			for _, name := range strings.Split(strings.ToUpper(argument), ",") {
+				day, ok := weekdays[name]
+				if !ok {
+					return Rule{}, fmt.Errorf("%w: BYDAY=%s", ErrUnsupportedRule, name)
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, number := range strings.Split(argument, ",") {
+				day, err := strconv.Atoi(number)
+				if err != nil || day == 0 || day < -31 || day > 31 {
+					return Rule{}, invalid("BYMONTHDAY=%s", number)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, day)
+			}
+		default:
+			return Rule{}, fmt.Errorf("%w: %s", ErrUnsupportedRule, key)
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return Rule{}, invalid("FREQ wajib diisi")
+	case rule.Count > 0 && !rule.Until.IsZero():
+		return Rule{}, invalid("COUNT dan UNTIL tidak boleh dipakai bersamaan")
+	case len(rule.ByDay) > 0 && rule.Freq == Yearly:
+		return Rule{}, fmt.Errorf("%w: BYDAY dengan FREQ=%s", ErrUnsupportedRule, rule.Freq)
+	case len(rule.ByMonthDay) > 0 && (rule.Freq == Weekly || rule.Freq == Yearly):
+		return Rule{}, fmt.Errorf("%w: BYMONTHDAY dengan FREQ=%s", ErrUnsupportedRule, rule.Freq)
+	}
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	if strings.Contains(value, "T") {
+		return time.ParseInLocation("20060102T150405", value, time.Local)
+	}
+	// UNTIL berupa tanggal berarti sampai akhir hari tersebut
+	until, err := time.ParseInLocation("20060102", value, time.Local)
+	return until.Add(24*time.Hour - time.Second), err
+}
+
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		var names []string
+		for _, day := range r.ByDay {
+			names = append(names, strings.ToUpper(day.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(names, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		var days []string
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// occurrence pertama setelah after untuk seri yang dimulai pada start (DTSTART)
+// false jika seri sudah selesai karna COUNT atau UNTIL
+func (r Rule) After(start time.Time, after time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	r.each(start, func(occurrence time.Time) bool {
+		if occurrence.After(after) {
+			next = occurrence
+			found = true
+			return false
+		}
+		return true
+	})
+	return next, found
+}
+
+// jumlah occurrence sebelum waktu before, dipakai untuk memecah seri yang memakai COUNT
+func (r Rule) CountBefore(start time.Time, before time.Time) int {
+	count := 0
+	r.each(start, func(occurrence time.Time) bool {
+		if !occurrence.Before(before) {
+			return false
+		}
+		count++
+		return true
+	})
+	return count
+}
+
+// panggil fn untuk setiap occurrence secara berurutan sampai fn mengembalikan false
+// start selalu menjadi occurrence pertama seperti DTSTART di RFC 5545
+func (r Rule) each(start time.Time, fn func(time.Time) bool) {
+	count := 0
+	emit := func(occurrence time.Time) bool {
+		if !r.Until.IsZero() && occurrence.After(r.Until) {
+			return false
+		}
+		count++
+		if !fn(occurrence) {
+			return false
+		}
+		return r.Count == 0 || count < r.Count
+	}
+
+	if !emit(start) {
+		return
+	}
+	for period := 0; period < maxPeriods; period++ {
+		for _, occurrence := range r.period(start, period) {
+			if occurrence.After(start) && !emit(occurrence) {
+				return
+			}
+		}
+	}
+}
+
+func (r Rule) period(start time.Time, period int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	}
+	step := period * r.Interval
+
+	var occurrences []time.Time
+	switch r.Freq {
+	case Daily:
+		day := start.AddDate(0, 0, step)
+		if r.matchDay(day) && r.matchMonthDay(day) {
+			occurrences = append(occurrences, day)
+		}
+	case Weekly:
+		// minggu dimulai hari senin (WKST=MO)
+		monday := start.AddDate(0, 0, -((int(start.Weekday())+6)%7)+7*step)
+		for offset := 0; offset < 7; offset++ {
+			day := monday.AddDate(0, 0, offset)
+			if len(r.ByDay) == 0 && day.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchDay(day) {
+				occurrences = append(occurrences, day)
+			}
+		}
+	case Monthly:
+		first := at(start.Year(), start.Month()+time.Month(step), 1)
+		last := first.AddDate(0, 1, -1).Day()
+		for day := 1; day <= last; day++ {
+			date := at(first.Year(), first.Month(), day)
+			switch {
+			case len(r.ByMonthDay) > 0:
+				if r.matchMonthDay(date) && r.matchDay(date) {
+					occurrences = append(occurrences, date)
+				}
+			case len(r.ByDay) > 0:
+				if r.matchDay(date) {
+					occurrences = append(occurrences, date)
+				}
+			case day == start.Day():
+				occurrences = append(occurrences, date)
+			}
+		}
+	case Yearly:
+		date := at(start.Year()+step, start.Month(), start.Day())
+		// 29 februari dilewati di tahun yang bukan kabisat
+		if date.Month() == start.Month() {
+			occurrences = append(occurrences, date)
+		}
+	}
+
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Before(occurrences[j]) })
+	return occurrences
+}
+
+func (r Rule) matchDay(date time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, day := range r.ByDay {
+		if date.Weekday() == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) matchMonthDay(date time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, date.Location()).Day()
+	for _, day := range r.ByMonthDay {
+		if day < 0 {
+			day = last + day + 1
+		}
+		if date.Day() == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+)
+
+type ErasePolicy string
+
+const (
+	EraseKeep         ErasePolicy = "keep"
+	EraseScrub        ErasePolicy = "scrub"
+	ErasePseudonymise ErasePolicy = "pseudonymise"
+	EraseDelete       ErasePolicy = "delete"
+)
+
+var ErrInvalidErasePolicy = errors.New("erase policy tidak didukung untuk table ini")
+
+// daftar table yang menyimpan data milik user
+// table yang punya foreign key ke users tidak bisa dipseudonimkan
+// table yang tidak menyimpan user id langsung memakai Condition, ? diisi user id
+type eraseTarget struct {
+	Table      string
+	UserColumn string
+	Condition  string
+	PIIColumns []string
+	HasFK      bool
+}
+
+func (t eraseTarget) where() string {
+	if t.Condition != "" {
+		return t.Condition
+	}
+	return t.UserColumn + " = ?"
+}
+
+var eraseTargets = []eraseTarget{
+	{Table: "addresses", UserColumn: "user_id", PIIColumns: []string{"address", "address_bidx"}, HasFK: true},
+	{Table: "wallets", UserColumn: "user_id", HasFK: true},
+	{Table: "user_like_product", UserColumn: "user_id", HasFK: true},
+	{Table: "user_logs", UserColumn: "user_id"},
+	{Table: "todo_collaborators", UserColumn: "user_id", HasFK: true},
+	{Table: "tags", UserColumn: "user_id", PIIColumns: []string{"name"}},
+	{Table: "todos", UserColumn: "user_id", PIIColumns: []string{"title", "description"}},
+	{Table: "todo_status_changes", UserColumn: "actor_id"},
+	{Table: "wallet_tier_changes", UserColumn: "user_id"},
+	{Table: "wallet_status_changes", UserColumn: "actor"},
+	// transfer terjadwal dari wallet user, riwayat eksekusinya dihapus dulu karna foreign key
+	{Table: "scheduled_transfer_runs", Condition: "scheduled_transfer_id IN (SELECT id FROM scheduled_transfers WHERE from_wallet_id IN (SELECT id FROM wallets WHERE user_id = ?))"},
+	{Table: "scheduled_transfers", Condition: "from_wallet_id IN (SELECT id FROM wallets WHERE user_id = ?)"},
+}
+
+// table users selalu di scrub, barisnya tetap ada supaya foreign key tidak rusak
+var userPIIColumns = []string{"password", "first_name", "middle_name", "last_name", "first_name_bidx"}
+
+var DefaultErasePolicies = map[string]ErasePolicy{
+	"addresses":               EraseDelete,
+	"wallets":                 EraseKeep,
+	"user_like_product":       EraseDelete,
+	"user_logs":               ErasePseudonymise,
+	"todo_collaborators":      EraseDelete,
+	"tags":                    EraseDelete,
+	"todos":                   EraseDelete,
+	"todo_status_changes":     ErasePseudonymise,
+	"wallet_tier_changes":     ErasePseudonymise,
+	"wallet_status_changes":   ErasePseudonymise,
+	"scheduled_transfer_runs": EraseDelete,
+	"scheduled_transfers":     EraseDelete,
+}
+
+type EraseTableReport struct {
+	Table        string
+	Policy       ErasePolicy
+	RowsAffected int64
+	// jumlah baris yang masih menyimpan data user setelah erase, harus 0
+	Remaining int64
+}
+
+type EraseReport struct {
+	UserId    string
+	Pseudonym string
+	ErasedAt  time.Time
+	Tables    []EraseTableReport
+	Verified  bool
+}
+
+// pseudonym dibuat deterministik supaya erase yang diulang hasilnya sama
+func Pseudonym(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return "erased-" + hex.EncodeToString(sum[:])[:16]
+}
+
+func (s *UserService) erasePolicy(table string) ErasePolicy {
+	if policy, ok := s.ErasePolicies[table]; ok {
+		return policy
+	}
+	if policy, ok := DefaultErasePolicies[table]; ok {
+		return policy
+	}
+	return EraseKeep
+}
+
+// hapus data pribadi user di semua table sesuai policy masing-masing
+// aman dipanggil berulang kali, pemanggilan kedua tidak merubah apa-apa
+func (s *UserService) EraseUser(ctx context.Context, id string) (*EraseReport, error) {
+	report := &EraseReport{UserId: id, Pseudonym: Pseudonym(id), ErasedAt: time.Now()}
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		err := tx.Unscoped().Take(&user, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		for _, target := range eraseTargets {
+			tableReport, err := eraseTable(tx, target, s.erasePolicy(target.Table), id, report.Pseudonym)
+			if err != nil {
+				return err
+			}
+			report.Tables = append(report.Tables, tableReport)
+		}
+
+		userTarget := eraseTarget{Table: "users", UserColumn: "id", PIIColumns: userPIIColumns, HasFK: true}
+		tableReport, err := eraseTable(tx, userTarget, EraseScrub, id, report.Pseudonym)
+		if err != nil {
+			return err
+		}
+		report.Tables = append(report.Tables, tableReport)
+
+		// user yang sudah dierase juga dinonaktifkan
+		return tx.Table("users").Where("id = ? AND deleted_at IS NULL", id).UpdateColumn("deleted_at", report.ErasedAt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Verified = true
+	for _, table := range report.Tables {
+		if table.Remaining != 0 {
+			report.Verified = false
+		}
+	}
+
+	return report, nil
+}
+
+func eraseTable(tx *gorm.DB, target eraseTarget, policy ErasePolicy, id string, pseudonym string) (EraseTableReport, error) {
+	report := EraseTableReport{Table: target.Table, Policy: policy}
+	where := target.where()
+
+	var result *gorm.DB
+	switch policy {
+	case EraseKeep:
+		return report, nil
+	case EraseScrub:
+		if len(target.PIIColumns) == 0 {
+			return report, fmt.Errorf("%w: %s %s", ErrInvalidErasePolicy, policy, target.Table)
+		}
+		values := map[string]interface{}{}
+		for _, column := range target.PIIColumns {
+			values[column] = ""
+		}
+		result = tx.Table(target.Table).Where(where, id).Updates(values)
+	case ErasePseudonymise:
+		if target.HasFK || target.UserColumn == "" {
+			return report, fmt.Errorf("%w: %s %s", ErrInvalidErasePolicy, policy, target.Table)
+		}
+		result = tx.Table(target.Table).Where(where, id).Update(target.UserColumn, pseudonym)
+	case EraseDelete:
+		result = tx.Exec("DELETE FROM "+target.Table+" WHERE "+where, id)
+	default:
+		return report, fmt.Errorf("%w: %s %s", ErrInvalidErasePolicy, policy, target.Table)
+	}
+	if result.Error != nil {
+		return report, result.Error
+	}
+	report.RowsAffected = result.RowsAffected
+
+	// verifikasi tidak ada lagi baris yang menyimpan data user
+	remaining := tx.Table(target.Table).Where(where, id)
+	if policy == EraseScrub {
+		conditions := make([]string, 0, len(target.PIIColumns))
+		for _, column := range target.PIIColumns {
+			conditions = append(conditions, column+" <> ''")
+		}
+		remaining = remaining.Where("(" + strings.Join(conditions, " OR ") + ")")
+	}
+	err := remaining.Count(&report.Remaining).Error
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
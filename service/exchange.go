@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"gorm.io/gorm"
+)
+
+var ErrRateNotFound = errors.New("kurs tidak ditemukan")
+
+// ambil kurs terbaru yang berlaku pada waktu at
+// jika hanya ada kurs kebalikannya (quote ke base) maka dipakai 1/rate
+func ExchangeRate(ctx context.Context, db *gorm.DB, base string, quote string, at time.Time) (*big.Rat, error) {
+	if base == quote {
+		return big.NewRat(1, 1), nil
+	}
+
+	var rate model.ExchangeRate
+	err := db.WithContext(ctx).Where("base_currency = ? AND quote_currency = ? AND effective_at <= ?", base, quote, at).
+		Order("effective_at desc").Take(&rate).Error
+	if err == nil {
+		return parseRate(rate.Rate)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = db.WithContext(ctx).Where("base_currency = ? AND quote_currency = ? AND effective_at <= ?", quote, base, at).
+		Order("effective_at desc").Take(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrRateNotFound, base, quote)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inverse, err := parseRate(rate.Rate)
+	if err != nil {
+		return nil, err
+	}
+	return inverse.Inv(inverse), nil
+}
+
+func parseRate(value string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(value)
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("rate tidak valid: %s", value)
+	}
+	return rate, nil
+}
+
+// konversi uang memakai kurs di table exchange_rates
+func Convert(ctx context.Context, db *gorm.DB, amount money.Money, currency string, mode money.RoundingMode, at time.Time) (money.Money, error) {
+	rate, err := ExchangeRate(ctx, db, amount.Currency, currency, at)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return amount.Convert(currency, rate, mode)
+}
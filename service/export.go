@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+)
+
+// naikkan versi jika format export berubah
+const ExportVersion = 3
+
+const redacted = "[REDACTED]"
+
+type UserExport struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	User       ExportedUser      `json:"user"`
+	Wallets    []ExportedWallet  `json:"wallets"`
+	Addresses  []ExportedAddress `json:"addresses"`
+	Likes      []ExportedProduct `json:"like_products"`
+	Todos      []ExportedTodo    `json:"todos"`
+	Shares     []ExportedShare   `json:"todo_shares"`
+	Tags       []ExportedTag     `json:"tags"`
+	UserLogs   []ExportedUserLog `json:"user_logs"`
+}
+
+type ExportedUser struct {
+	Id            string     `json:"id"`
+	Password      string     `json:"password"`
+	FirstName     string     `json:"first_name"`
+	MiddleName    string     `json:"middle_name"`
+	LastName      string     `json:"last_name"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+}
+
+type ExportedWallet struct {
+	Id        string    `json:"id"`
+	Balance   int64     `json:"balance"`
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportedAddress struct {
+	Address   string     `json:"address"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+type ExportedProduct struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Price    int64  `json:"price"`
+	Currency string `json:"currency"`
+}
+
+type ExportedTodo struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+}
+
+type ExportedTag struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// todo milik user lain yang dibagikan ke user
+type ExportedShare struct {
+	TodoTitle string    `json:"todo_title"`
+	Role      string    `json:"role"`
+	SharedAt  time.Time `json:"shared_at"`
+}
+
+type ExportedUserLog struct {
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// todo_collaborators punya primary key gabungan, user_id sudah pasti sama jadi paging cukup dengan todo_id
+type sharedTodoRow struct {
+	TodoId    uint `gorm:"column:todo_id;primaryKey"`
+	Title     string
+	Role      string
+	CreatedAt time.Time
+}
+
+func deletedAtPtr(deletedAt gorm.DeletedAt) *time.Time {
+	if !deletedAt.Valid {
+		return nil
+	}
+	return &deletedAt.Time
+}
+
+// jumlah baris yang dibaca per query saat export
+var ExportBatchSize = 500
+
+// penulis dokumen json sedikit demi sedikit, error pertama disimpan dan penulisan berikutnya diabaikan
+type exportStream struct {
+	w       io.Writer
+	encoder *json.Encoder
+	err     error
+}
+
+func (e *exportStream) raw(text string) {
+	if e.err == nil {
+		_, e.err = io.WriteString(e.w, text)
+	}
+}
+
+func (e *exportStream) value(value interface{}) {
+	if e.err == nil {
+		e.err = e.encoder.Encode(value)
+	}
+}
+
+// tulis satu field array, baris dibaca per halaman sehingga data user yang besar tidak dimuat sekaligus
+func exportSection[T any, E any](stream *exportStream, name string, query *gorm.DB, convert func(row T) E) error {
+	stream.raw(`,"` + name + `":[`)
+	first := true
+	var rows []T
+	err := query.FindInBatches(&rows, ExportBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, row := range rows {
+			if !first {
+				stream.raw(",")
+			}
+			first = false
+			stream.value(convert(row))
+		}
+		return stream.err
+	}).Error
+	if err != nil {
+		return err
+	}
+	stream.raw("]")
+	return stream.err
+}
+
+// export semua data milik user (subject access request) ke format json dengan bentuk UserExport
+// dokumen ditulis langsung ke w per section, password dan field internal seperti id auto increment tidak ikut diexport
+func (s *UserService) ExportUser(ctx context.Context, id string, w io.Writer) error {
+	// satu transaction supaya semua section dibaca dari snapshot yang sama
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// data yang sudah di soft delete juga tetap bagian dari data user
+		tx = tx.Unscoped().Session(&gorm.Session{})
+
+		var user model.User
+		err := tx.Take(&user, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		stream := &exportStream{w: w, encoder: json.NewEncoder(w)}
+		stream.raw(`{"version":`)
+		stream.value(ExportVersion)
+		stream.raw(`,"exported_at":`)
+		stream.value(time.Now())
+		stream.raw(`,"user":`)
+		stream.value(ExportedUser{
+			Id:            user.Id,
+			Password:      redacted,
+			FirstName:     user.Name.FirstName,
+			MiddleName:    user.Name.MiddleName,
+			LastName:      user.Name.LastName,
+			CreatedAt:     user.CreatedAt,
+			DeactivatedAt: deletedAtPtr(user.DeletedAt),
+		})
+
+		err = exportSection(stream, "wallets", tx.Where("user_id = ?", id), func(wallet model.Wallet) ExportedWallet {
+			return ExportedWallet{
+				Id:        wallet.Id,
+				Balance:   wallet.Balance.Amount,
+				Currency:  wallet.Currency,
+				CreatedAt: wallet.CreatedAt,
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		err = exportSection(stream, "addresses", tx.Where("user_id = ?", id), func(address model.Address) ExportedAddress {
+			return ExportedAddress{
+				Address:   address.Address,
+				CreatedAt: address.CreatedAt,
+				DeletedAt: deletedAtPtr(address.DeletedAt),
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		likes := tx.Joins("JOIN user_like_product ON user_like_product.product_id = products.id").
+			Where("user_like_product.user_id = ?", id)
+		err = exportSection(stream, "like_products", likes, func(product model.Product) ExportedProduct {
+			return ExportedProduct{
+				Id:       product.ID,
+				Name:     product.Name,
+				Price:    product.Price.Amount,
+				Currency: product.Currency,
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		err = exportSection(stream, "todos", tx.Where("user_id = ?", id), func(todo model.Todo) ExportedTodo {
+			return ExportedTodo{
+				Title:       todo.Title,
+				Description: todo.Description,
+				CreatedAt:   todo.CreatedAt,
+				UpdatedAt:   todo.UpdatedAt,
+				DeletedAt:   deletedAtPtr(todo.DeletedAt),
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		err = exportSection(stream, "tags", tx.Where("user_id = ?", id), func(tag model.Tag) ExportedTag {
+			return ExportedTag{
+				Name:      tag.Name,
+				CreatedAt: tag.CreatedAt,
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		shares := tx.Table("todo_collaborators").
+			Select("todo_collaborators.todo_id, todos.title, todo_collaborators.role, todo_collaborators.created_at").
+			Joins("JOIN todos ON todos.id = todo_collaborators.todo_id").
+			Where("todo_collaborators.user_id = ?", id)
+		err = exportSection(stream, "todo_shares", shares, func(share sharedTodoRow) ExportedShare {
+			return ExportedShare{
+				TodoTitle: share.Title,
+				Role:      share.Role,
+				SharedAt:  share.CreatedAt,
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		err = exportSection(stream, "user_logs", tx.Where("user_id = ?", id), func(userLog model.UserLog) ExportedUserLog {
+			return ExportedUserLog{
+				Action:    userLog.Action,
+				CreatedAt: time.UnixMilli(userLog.CreatedAt),
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		stream.raw("}\n")
+		return stream.err
+	})
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldVoided   = "voided"
+	HoldExpired  = "expired"
+)
+
+var (
+	ErrHoldNotActive  = errors.New("hold sudah tidak aktif")
+	ErrCaptureExceeds = errors.New("amount capture melebihi amount hold")
+	ErrInvalidHoldTTL = errors.New("masa berlaku hold harus lebih dari 0")
+)
+
+// total dana yang sedang ditahan di wallet, wallet harus sudah di lock
+func activeHolds(tx *gorm.DB, walletId string, now time.Time) (int64, error) {
+	var total int64
+	err := tx.Model(&model.WalletHold{}).Select("coalesce(sum(amount), 0)").
+		Where("wallet_id = ? AND status = ? AND expires_at > ?", walletId, HoldActive, now).Scan(&total).Error
+	return total, err
+}
+
+// saldo yang bisa dipakai = balance - hold yang masih aktif
+func (s *WalletService) AvailableBalance(ctx context.Context, walletId string) (int64, error) {
+	var available int64
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		wallet, err := lockWallet(tx, walletId)
+		if err != nil {
+			return err
+		}
+
+		held, err := activeHolds(tx, walletId, time.Now())
+		if err != nil {
+			return err
+		}
+
+		available = wallet.Balance.Amount - held
+		return nil
+	})
+	return available, err
+}
+
+// tahan dana wallet selama ttl, dana yang ditahan tidak bisa dipakai debit lain
+// mata uang amount harus sama dengan mata uang wallet
+func (s *WalletService) Authorize(ctx context.Context, walletId string, amount money.Money, ttl time.Duration) (*model.WalletHold, error) {
+	if amount.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if ttl <= 0 {
+		return nil, ErrInvalidHoldTTL
+	}
+
+	var hold model.WalletHold
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		wallet, err := lockWallet(tx, walletId)
+		if err != nil {
+			return err
+		}
+		err = ensureWalletActive(wallet)
+		if err != nil {
+			return err
+		}
+		if amount.Currency != wallet.Currency {
+			return fmt.Errorf("%w: %s dan %s", money.ErrCurrencyMismatch, amount.Currency, wallet.Currency)
+		}
+
+		now := time.Now()
+		held, err := activeHolds(tx, walletId, now)
+		if err != nil {
+			return err
+		}
+		if wallet.Balance.Amount-held < amount.Amount {
+			return ErrInsufficientBalance
+		}
+
+		hold = model.WalletHold{
+			WalletId:  walletId,
+			Amount:    amount,
+			Status:    HoldActive,
+			ExpiresAt: now.Add(ttl),
+		}
+		return tx.Create(&hold).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// lock wallet dulu baru hold, urutannya sama dengan Authorize supaya tidak deadlock
+func lockHold(tx *gorm.DB, holdId int64) (*model.WalletHold, error) {
+	var hold model.WalletHold
+	err := tx.Take(&hold, "id = ?", holdId).Error
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = lockWallet(tx, hold.WalletId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&hold, "id = ?", holdId).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if hold.Status != HoldActive || !hold.ExpiresAt.After(time.Now()) {
+		return nil, ErrHoldNotActive
+	}
+	return &hold, nil
+}
+
+// ambil dana yang ditahan, amount boleh lebih kecil dari hold (partial capture)
+// sisa dana yang tidak dicapture otomatis dilepas
+func (s *WalletService) Capture(ctx context.Context, holdId int64, amount money.Money) (*model.WalletEntry, error) {
+	if amount.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	var entry *model.WalletEntry
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		hold, err := lockHold(tx, holdId)
+		if err != nil {
+			return err
+		}
+		compare, err := amount.Compare(hold.Amount)
+		if err != nil {
+			return err
+		}
+		if compare > 0 {
+			return ErrCaptureExceeds
+		}
+
+		// status diubah dulu supaya hold ini tidak ikut dihitung saat debit
+		err = tx.Model(hold).Updates(map[string]interface{}{"status": HoldCaptured, "captured_amount": amount}).Error
+		if err != nil {
+			return err
+		}
+
+		entry, err = postWallet(tx, hold.WalletId, -amount.Amount, "hold", strconv.FormatInt(hold.ID, 10))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (s *WalletService) Void(ctx context.Context, holdId int64) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		hold, err := lockHold(tx, holdId)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(hold).Update("status", HoldVoided).Error
+	})
+}
+
+// tandai hold yang sudah lewat masa berlakunya sebagai expired
+func (s *WalletService) ExpireHolds(ctx context.Context, now time.Time) (int64, error) {
+	result := s.DB.WithContext(ctx).Model(&model.WalletHold{}).
+		Where("status = ? AND expires_at <= ?", HoldActive, now).Update("status", HoldExpired)
+	return result.RowsAffected, result.Error
+}
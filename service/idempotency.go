@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+// lama idempotency key disimpan sebelum boleh dipakai ulang
+var IdempotencyTTL = 24 * time.Hour
+
+const idempotencyMaxRetries = 5
+
+var ErrIdempotencyKeyMismatch = errors.New("idempotency key sudah dipakai untuk request yang berbeda")
+
+func requestHash(request interface{}) (string, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// jalankan fn tepat satu kali per key, key dan hasil fn disimpan dalam transaction yang sama
+// request yang diulang dengan key yang sama mendapat hasil yang tersimpan tanpa menjalankan fn lagi
+func RunIdempotent[T any](ctx context.Context, db *gorm.DB, key string, request interface{}, fn func(tx *gorm.DB) (T, error)) (T, error) {
+	var response T
+	hash, err := requestHash(request)
+	if err != nil {
+		return response, err
+	}
+
+	// diulang jika request lain dengan key yang sama commit lebih dulu (duplicate key saat insert key)
+	// atau dua insert key yang sama saling menunggu gap lock (deadlock / lock wait timeout)
+	// percobaan berikutnya akan membaca hasil yang sudah tersimpan
+	// duplicate key dari fn adalah konflik data sungguhan, jadi langsung dikembalikan
+	for attempt := 0; attempt < idempotencyMaxRetries; attempt++ {
+		var zero T
+		response = zero
+		keyConflict := false
+		err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var idempotencyKey model.IdempotencyKey
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&idempotencyKey, "idempotency_key = ?", key).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			found := err == nil
+			if found && idempotencyKey.ExpiresAt.Before(time.Now()) {
+				err = tx.Delete(&idempotencyKey).Error
+				if err != nil {
+					return err
+				}
+				found = false
+			}
+
+			if found {
+				if idempotencyKey.RequestHash != hash {
+					return ErrIdempotencyKeyMismatch
+				}
+				return json.Unmarshal([]byte(idempotencyKey.Response), &response)
+			}
+
+			idempotencyKey = model.IdempotencyKey{
+				Key:         key,
+				RequestHash: hash,
+				Status:      IdempotencyProcessing,
+				ExpiresAt:   time.Now().Add(IdempotencyTTL),
+			}
+			err = tx.Create(&idempotencyKey).Error
+			if err != nil {
+				keyConflict = isDuplicateKey(err)
+				return err
+			}
+
+			response, err = fn(tx)
+			if err != nil {
+				return err
+			}
+
+			snapshot, err := json.Marshal(response)
+			if err != nil {
+				return err
+			}
+
+			return tx.Model(&idempotencyKey).Updates(map[string]interface{}{
+				"status":   IdempotencyCompleted,
+				"response": string(snapshot),
+			}).Error
+		})
+		if err == nil || !(keyConflict || isRetryable(err)) {
+			break
+		}
+		time.Sleep(time.Duration(attempt+1) * 10 * time.Millisecond)
+	}
+
+	return response, err
+}
+
+// hapus idempotency key yang sudah kadaluarsa
+func PurgeExpiredIdempotencyKeys(ctx context.Context, db *gorm.DB) (int64, error) {
+	result := db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&model.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
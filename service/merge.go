@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/rank"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrMergeSameUser = errors.New("tidak bisa merge user dengan dirinya sendiri")
+
+type MergeSummary struct {
+	KeepId         string
+	DropId         string
+	AddressesMoved int64
+	TodosMoved     int64
+	UserLogsMoved  int64
+	LikesMerged    int64
+	// akses todo milik user lain yang dipindah ke keepId
+	SharesMoved int64
+	// tag dropId yang dipindah atau digabung ke tag keepId dengan nama yang sama
+	TagsMerged int64
+	// total saldo yang dipindah per mata uang
+	BalanceMerged map[string]int64
+	WalletsMoved  int
+}
+
+// gabungkan dua akun user yang duplikat, semua data dropId dipindah ke keepId
+// lalu dropId di soft delete
+func (s *UserService) MergeUsers(ctx context.Context, keepId string, dropId string) (*MergeSummary, error) {
+	if keepId == dropId {
+		return nil, ErrMergeSameUser
+	}
+
+	summary := &MergeSummary{KeepId: keepId, DropId: dropId, BalanceMerged: map[string]int64{}}
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// lock dengan urutan id yang sama supaya tidak deadlock dengan merge lain
+		ids := []string{keepId, dropId}
+		sort.Strings(ids)
+		var users []model.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id asc").Find(&users, "id in ?", ids).Error
+		if err != nil {
+			return err
+		}
+		if len(users) != 2 {
+			return gorm.ErrRecordNotFound
+		}
+
+		result := tx.Unscoped().Model(&model.Address{}).Where("user_id = ?", dropId).Update("user_id", keepId)
+		if result.Error != nil {
+			return result.Error
+		}
+		summary.AddressesMoved = result.RowsAffected
+
+		err = mergeTodos(tx, summary)
+		if err != nil {
+			return err
+		}
+
+		result = tx.Model(&model.UserLog{}).Where("user_id = ?", dropId).Update("user_id", keepId)
+		if result.Error != nil {
+			return result.Error
+		}
+		summary.UserLogsMoved = result.RowsAffected
+
+		err = mergeWallets(tx, summary)
+		if err != nil {
+			return err
+		}
+
+		err = mergeLikes(tx, summary)
+		if err != nil {
+			return err
+		}
+
+		err = mergeCollaborators(tx, summary)
+		if err != nil {
+			return err
+		}
+
+		err = mergeUserTags(tx, summary)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&model.User{}).Where("id = ?", dropId).UpdateColumn("deleted_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// todo dropId ditaruh di bawah list keepId dengan urutan yang sama seperti sebelumnya
+// rank diberi ulang supaya tidak berselang-seling atau kembar dengan rank todo keepId
+func mergeTodos(tx *gorm.DB, summary *MergeSummary) error {
+	keepTodos, err := lockRanks(tx.Unscoped(), summary.KeepId)
+	if err != nil {
+		return err
+	}
+
+	dropTodos, err := lockRanks(tx.Unscoped(), summary.DropId)
+	if err != nil {
+		return err
+	}
+
+	last := ""
+	for _, todo := range keepTodos {
+		if todo.Rank > last {
+			last = todo.Rank
+		}
+	}
+
+	for _, todo := range dropTodos {
+		last = rank.After(last)
+		err = tx.Unscoped().Model(&model.Todo{}).Where("id = ?", todo.ID).
+			UpdateColumns(map[string]interface{}{"user_id": summary.KeepId, "rank_key": last}).Error
+		if err != nil {
+			return err
+		}
+	}
+	summary.TodosMoved = int64(len(dropTodos))
+
+	return nil
+}
+
+// wallet digabung per mata uang, saldo dipindah lewat ledger supaya tercatat di kedua wallet
+func mergeWallets(tx *gorm.DB, summary *MergeSummary) error {
+	var wallets []model.Wallet
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id asc").Find(&wallets, "user_id in ?", []string{summary.KeepId, summary.DropId}).Error
+	if err != nil {
+		return err
+	}
+
+	keepWallets := map[string]*model.Wallet{}
+	for i := range wallets {
+		if wallets[i].UserId == summary.KeepId {
+			keepWallets[wallets[i].Currency] = &wallets[i]
+		}
+	}
+
+	for i := range wallets {
+		dropWallet := &wallets[i]
+		if dropWallet.UserId != summary.DropId {
+			continue
+		}
+
+		// user yang dipertahankan belum punya wallet dengan mata uang ini, cukup pindahkan walletnya
+		keepWallet, ok := keepWallets[dropWallet.Currency]
+		if !ok {
+			err = tx.Model(dropWallet).UpdateColumn("user_id", summary.KeepId).Error
+			if err != nil {
+				return err
+			}
+			summary.WalletsMoved++
+			continue
+		}
+
+		balance := dropWallet.Balance.Amount
+		if balance != 0 {
+			_, err = postEntry(tx, dropWallet, -balance, "merge", keepWallet.Id)
+			if err != nil {
+				return err
+			}
+
+			_, err = postEntry(tx, keepWallet, balance, "merge", dropWallet.Id)
+			if err != nil {
+				return err
+			}
+			summary.BalanceMerged[dropWallet.Currency] += balance
+		}
+
+		err = tx.Model(dropWallet).UpdateColumn("deleted_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// union like product kedua user tanpa melanggar primary key (user_id, product_id)
+func mergeLikes(tx *gorm.DB, summary *MergeSummary) error {
+	var keepProducts, dropProducts []string
+	err := tx.Table("user_like_product").Where("user_id = ?", summary.KeepId).Pluck("product_id", &keepProducts).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Table("user_like_product").Where("user_id = ?", summary.DropId).Pluck("product_id", &dropProducts).Error
+	if err != nil {
+		return err
+	}
+
+	liked := map[string]bool{}
+	for _, productId := range keepProducts {
+		liked[productId] = true
+	}
+
+	var likes []map[string]interface{}
+	for _, productId := range dropProducts {
+		if !liked[productId] {
+			likes = append(likes, map[string]interface{}{"user_id": summary.KeepId, "product_id": productId})
+		}
+	}
+
+	if len(likes) > 0 {
+		err = tx.Table("user_like_product").Create(likes).Error
+		if err != nil {
+			return err
+		}
+	}
+	summary.LikesMerged = int64(len(likes))
+
+	return tx.Exec("DELETE FROM user_like_product WHERE user_id = ?", summary.DropId).Error
+}
+
+// pindahkan akses collaborator dropId ke keepId tanpa melanggar primary key (todo_id, user_id)
+// harus dijalankan setelah todo dropId dipindah ke keepId
+func mergeCollaborators(tx *gorm.DB, summary *MergeSummary) error {
+	// todo yang sekarang milik keepId tidak perlu dibagikan ke pemiliknya sendiri
+	owned := tx.Unscoped().Model(&model.Todo{}).Select("id").Where("user_id = ?", summary.KeepId)
+	err := tx.Where("user_id IN ? AND todo_id IN (?)", []string{summary.KeepId, summary.DropId}, owned).Delete(&model.TodoCollaborator{}).Error
+	if err != nil {
+		return err
+	}
+
+	var dropShares []model.TodoCollaborator
+	err = tx.Where("user_id = ?", summary.DropId).Find(&dropShares).Error
+	if err != nil {
+		return err
+	}
+
+	for _, share := range dropShares {
+		var keepShares []model.TodoCollaborator
+		err = tx.Where("todo_id = ? AND user_id = ?", share.TodoId, summary.KeepId).Find(&keepShares).Error
+		if err != nil {
+			return err
+		}
+
+		if len(keepShares) == 0 {
+			err = tx.Model(&model.TodoCollaborator{}).Where("todo_id = ? AND user_id = ?", share.TodoId, summary.DropId).
+				Update("user_id", summary.KeepId).Error
+			if err != nil {
+				return err
+			}
+			summary.SharesMoved++
+			continue
+		}
+
+		// keduanya sudah punya akses, role yang lebih tinggi yang dipakai
+		if share.Role == CollaboratorEditor && keepShares[0].Role != CollaboratorEditor {
+			err = tx.Model(&model.TodoCollaborator{}).Where("todo_id = ? AND user_id = ?", share.TodoId, summary.KeepId).
+				Update("role", CollaboratorEditor).Error
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Where("todo_id = ? AND user_id = ?", share.TodoId, summary.DropId).Delete(&model.TodoCollaborator{}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tag dropId dipindah ke keepId, tag dengan nama yang sudah dimiliki keepId digabung
+// sehingga todo yang dipindah tidak lagi memakai tag milik dropId
+func mergeUserTags(tx *gorm.DB, summary *MergeSummary) error {
+	var tags []model.Tag
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id IN ?", []string{summary.KeepId, summary.DropId}).Order("id asc").Find(&tags).Error
+	if err != nil {
+		return err
+	}
+
+	keepTags := map[string]int64{}
+	for _, tag := range tags {
+		if tag.UserId == summary.KeepId {
+			keepTags[tag.Name] = tag.ID
+		}
+	}
+
+	for _, tag := range tags {
+		if tag.UserId != summary.DropId {
+			continue
+		}
+
+		if targetId, ok := keepTags[tag.Name]; ok {
+			err = mergeTag(tx, tag.ID, targetId)
+		} else {
+			err = tx.Model(&model.Tag{}).Where("id = ?", tag.ID).Update("user_id", summary.KeepId).Error
+		}
+		if err != nil {
+			return err
+		}
+		summary.TagsMerged++
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"gorm.io/gorm"
+)
+
+type BalanceMismatch struct {
+	WalletId      string
+	Balance       int64
+	LedgerBalance int64
+}
+
+func (m BalanceMismatch) Difference() int64 {
+	return m.Balance - m.LedgerBalance
+}
+
+type ReconciliationReport struct {
+	// termasuk wallet yang sudah di soft delete, entry ledgernya tetap harus cocok
+	Mismatches []BalanceMismatch
+	// wallet aktif yang usernya tidak ada atau sudah di soft delete
+	OrphanWallets []string
+	// entry yang ditulis ke wallet setelah usernya di soft delete
+	OrphanEntries   []int64
+	NegativeWallets []string
+	// jumlah entry koreksi yang ditulis saat mode fix
+	Fixed int
+}
+
+func (r *ReconciliationReport) HasIssues() bool {
+	return len(r.Mismatches) > r.Fixed || len(r.OrphanWallets) > 0 || len(r.OrphanEntries) > 0 || len(r.NegativeWallets) > 0
+}
+
+func (r *ReconciliationReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Balance tidak sesuai ledger: %d\n", len(r.Mismatches))
+	for _, mismatch := range r.Mismatches {
+		fmt.Fprintf(w, "  wallet %s balance %d ledger %d selisih %d\n", mismatch.WalletId, mismatch.Balance, mismatch.LedgerBalance, mismatch.Difference())
+	}
+
+	fmt.Fprintf(w, "Wallet tanpa user aktif: %d\n", len(r.OrphanWallets))
+	for _, walletId := range r.OrphanWallets {
+		fmt.Fprintf(w, "  wallet %s\n", walletId)
+	}
+
+	fmt.Fprintf(w, "Entry setelah user dihapus: %d\n", len(r.OrphanEntries))
+	for _, entryId := range r.OrphanEntries {
+		fmt.Fprintf(w, "  entry %d\n", entryId)
+	}
+
+	fmt.Fprintf(w, "Wallet dengan balance negatif: %d\n", len(r.NegativeWallets))
+	for _, walletId := range r.NegativeWallets {
+		fmt.Fprintf(w, "  wallet %s\n", walletId)
+	}
+
+	if r.Fixed > 0 {
+		fmt.Fprintf(w, "Entry koreksi ditulis: %d\n", r.Fixed)
+	}
+}
+
+// cocokkan balance setiap wallet dengan total entry ledgernya
+// jika fix true, selisihnya dicatat sebagai entry koreksi dengan balance wallet sebagai acuan
+func (s *WalletService) Reconcile(ctx context.Context, fix bool) (*ReconciliationReport, error) {
+	tx := s.DB.WithContext(ctx)
+	report := &ReconciliationReport{}
+
+	err := tx.Unscoped().Model(&model.Wallet{}).
+		Select("wallets.id as wallet_id, wallets.balance as balance, coalesce(sum(wallet_entries.amount), 0) as ledger_balance").
+		Joins("LEFT JOIN wallet_entries ON wallet_entries.wallet_id = wallets.id").
+		Group("wallets.id, wallets.balance").
+		Having("wallets.balance <> coalesce(sum(wallet_entries.amount), 0)").
+		Order("wallets.id asc").
+		Scan(&report.Mismatches).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// user_id punya foreign key, jadi user yang hilang biasanya karna di soft delete
+	err = tx.Model(&model.Wallet{}).
+		Joins("LEFT JOIN users ON users.id = wallets.user_id").
+		Where("users.id IS NULL OR users.deleted_at IS NOT NULL").
+		Order("wallets.id asc").
+		Pluck("wallets.id", &report.OrphanWallets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Model(&model.WalletEntry{}).
+		Joins("JOIN wallets ON wallets.id = wallet_entries.wallet_id").
+		Joins("JOIN users ON users.id = wallets.user_id").
+		Where("users.deleted_at IS NOT NULL AND wallet_entries.created_at > users.deleted_at").
+		Order("wallet_entries.id asc").
+		Pluck("wallet_entries.id", &report.OrphanEntries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Model(&model.Wallet{}).Where("balance < 0").Order("id asc").Pluck("id", &report.NegativeWallets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if !fix {
+		return report, nil
+	}
+
+	for _, mismatch := range report.Mismatches {
+		fixed := false
+		err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			wallet, err := lockWallet(tx.Unscoped(), mismatch.WalletId)
+			if err != nil {
+				return err
+			}
+
+			// hitung ulang di dalam lock, bisa saja sudah berubah sejak laporan dibuat
+			var ledgerBalance int64
+			err = tx.Model(&model.WalletEntry{}).Select("coalesce(sum(amount), 0)").Where("wallet_id = ?", wallet.Id).Scan(&ledgerBalance).Error
+			if err != nil {
+				return err
+			}
+			if wallet.Balance.Amount == ledgerBalance {
+				return nil
+			}
+
+			fixed = true
+			return tx.Create(&model.WalletEntry{
+				WalletId:      wallet.Id,
+				Amount:        money.New(wallet.Balance.Amount-ledgerBalance, wallet.Currency),
+				BalanceAfter:  wallet.Balance,
+				ReferenceType: "reconciliation",
+				ReferenceId:   newReferenceId("reconcile"),
+			}).Error
+		})
+		if err != nil {
+			return report, err
+		}
+		if fixed {
+			report.Fixed++
+		}
+	}
+
+	return report, nil
+}
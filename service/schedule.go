@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("ekspresi jadwal tidak valid")
+
+// ekspresi jadwal yang didukung:
+//
+//	once          sekali saja
+//	daily         setiap hari
+//	weekly:monday setiap hari senin
+//	monthly:1     setiap tanggal 1, tanggal yang tidak ada di bulan itu dipakai tanggal terakhirnya
+//
+// jam eksekusi mengikuti jam dari waktu eksekusi pertama
+type Schedule struct {
+	Kind    string
+	Weekday time.Weekday
+	Day     int
+}
+
+func ParseSchedule(expression string) (Schedule, error) {
+	kind, argument, _ := strings.Cut(strings.ToLower(strings.TrimSpace(expression)), ":")
+	switch kind {
+	case "once", "daily":
+		if argument != "" {
+			return Schedule{}, fmt.Errorf("%w: %s", ErrInvalidSchedule, expression)
+		}
+		return Schedule{Kind: kind}, nil
+	case "weekly":
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if strings.ToLower(day.String()) == argument {
+				return Schedule{Kind: kind, Weekday: day}, nil
+			}
+		}
+	case "monthly":
+		day, err := strconv.Atoi(argument)
+		if err == nil && day >= 1 && day <= 31 {
+			return Schedule{Kind: kind, Day: day}, nil
+		}
+	}
+	return Schedule{}, fmt.Errorf("%w: %s", ErrInvalidSchedule, expression)
+}
+
+// jadwal berikutnya setelah after, false jika jadwal tidak berulang
+func (s Schedule) Next(after time.Time) (time.Time, bool) {
+	switch s.Kind {
+	case "daily":
+		return after.AddDate(0, 0, 1), true
+	case "weekly":
+		days := (int(s.Weekday)-int(after.Weekday())+6)%7 + 1
+		return after.AddDate(0, 0, days), true
+	case "monthly":
+		next := monthDay(after.Year(), after.Month(), s.Day, after)
+		if !next.After(after) {
+			next = monthDay(after.Year(), after.Month()+1, s.Day, after)
+		}
+		return next, true
+	}
+	return time.Time{}, false
+}
+
+// tanggal day di bulan month, dibatasi tanggal terakhir bulan tersebut
+func monthDay(year int, month time.Month, day int, clock time.Time) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, clock.Location()).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month, day, clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), clock.Location())
+}
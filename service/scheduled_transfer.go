@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"gorm.io/gorm"
+)
+
+const (
+	ScheduleActive    = "active"
+	ScheduleCompleted = "completed"
+	ScheduleCancelled = "cancelled"
+
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// claim sudah diambil instance lain karna lease habis
+var errClaimLost = errors.New("claim transfer terjadwal sudah diambil instance lain")
+
+type TransferScheduler struct {
+	DB *gorm.DB
+	// jam yang dipakai runner, bisa diganti di test
+	Now func() time.Time
+	// nama instance yang menjalankan runner
+	Instance string
+	// lama claim berlaku sebelum boleh diambil instance lain
+	Lease     time.Duration
+	BatchSize int
+}
+
+func NewTransferScheduler(db *gorm.DB) *TransferScheduler {
+	hostname, _ := os.Hostname()
+	return &TransferScheduler{
+		DB:        db,
+		Now:       time.Now,
+		Instance:  hostname + "-" + strconv.Itoa(os.Getpid()),
+		Lease:     time.Minute,
+		BatchSize: 100,
+	}
+}
+
+// mata uang amount harus sama dengan mata uang kedua wallet
+func (s *TransferScheduler) Schedule(ctx context.Context, fromWalletId string, toWalletId string, amount money.Money, expression string, firstRunAt time.Time) (*model.ScheduledTransfer, error) {
+	if amount.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if fromWalletId == toWalletId {
+		return nil, ErrSameWallet
+	}
+	_, err := ParseSchedule(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	var wallets []model.Wallet
+	err = s.DB.WithContext(ctx).Where("id IN ?", []string{fromWalletId, toWalletId}).Find(&wallets).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(wallets) != 2 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	for _, wallet := range wallets {
+		if wallet.Currency != amount.Currency {
+			return nil, fmt.Errorf("%w: %s dan %s", money.ErrCurrencyMismatch, amount.Currency, wallet.Currency)
+		}
+	}
+
+	scheduled := &model.ScheduledTransfer{
+		FromWalletId: fromWalletId,
+		ToWalletId:   toWalletId,
+		Amount:       amount,
+		Schedule:     expression,
+		NextRunAt:    firstRunAt,
+		Status:       ScheduleActive,
+	}
+	err = s.DB.WithContext(ctx).Create(scheduled).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+func (s *TransferScheduler) Cancel(ctx context.Context, id int64) error {
+	return s.DB.WithContext(ctx).Model(&model.ScheduledTransfer{}).
+		Where("id = ? AND status = ?", id, ScheduleActive).Update("status", ScheduleCancelled).Error
+}
+
+type ScheduleRunReport struct {
+	Claimed   int
+	Succeeded int
+	Failed    int
+}
+
+// jalankan semua transfer terjadwal yang sudah jatuh tempo
+// aman dijalankan di banyak instance sekaligus, setiap baris hanya dieksekusi oleh instance yang berhasil claim
+func (s *TransferScheduler) RunDue(ctx context.Context) (*ScheduleRunReport, error) {
+	now := s.Now()
+	report := &ScheduleRunReport{}
+
+	var ids []int64
+	err := s.DB.WithContext(ctx).Model(&model.ScheduledTransfer{}).
+		Where("status = ? AND next_run_at <= ? AND (claimed_until IS NULL OR claimed_until < ?)", ScheduleActive, now, now).
+		Order("next_run_at asc, id asc").Limit(s.BatchSize).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		scheduled, err := s.claim(ctx, id, now)
+		if err != nil {
+			return report, err
+		}
+		if scheduled == nil {
+			continue
+		}
+		report.Claimed++
+
+		err = s.run(ctx, scheduled, now)
+		if errors.Is(err, errClaimLost) {
+			continue
+		}
+		if err != nil {
+			report.Failed++
+			err = s.fail(ctx, scheduled, now, err)
+			if err != nil && !errors.Is(err, errClaimLost) {
+				return report, err
+			}
+			continue
+		}
+		report.Succeeded++
+	}
+
+	return report, nil
+}
+
+// claim memakai token unik per claim, update hanya berhasil jika baris belum di claim instance lain
+func (s *TransferScheduler) claim(ctx context.Context, id int64, now time.Time) (*model.ScheduledTransfer, error) {
+	token := newReferenceId(s.Instance)
+	result := s.DB.WithContext(ctx).Model(&model.ScheduledTransfer{}).
+		Where("id = ? AND status = ? AND next_run_at <= ? AND (claimed_until IS NULL OR claimed_until < ?)", id, ScheduleActive, now, now).
+		Updates(map[string]interface{}{"claimed_by": token, "claimed_until": now.Add(s.Lease)})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+
+	var scheduled model.ScheduledTransfer
+	err := s.DB.WithContext(ctx).Take(&scheduled, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &scheduled, nil
+}
+
+// transfer, hasil eksekusi dan jadwal berikutnya ditulis dalam satu transaction
+// memakai retry dan urutan lock yang sama dengan WalletService.Transfer
+func (s *TransferScheduler) run(ctx context.Context, scheduled *model.ScheduledTransfer, now time.Time) error {
+	result := &TransferResult{ReferenceId: newReferenceId("scheduled")}
+	return retryTransaction(ctx, s.DB, func(tx *gorm.DB) error {
+		err := s.advance(tx, scheduled, now, "")
+		if err != nil {
+			return err
+		}
+
+		err = transfer(tx, scheduled.FromWalletId, scheduled.ToWalletId, scheduled.Amount.Amount, result)
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&model.ScheduledTransferRun{
+			ScheduledTransferId: scheduled.ID,
+			ScheduledAt:         scheduled.NextRunAt,
+			Status:              RunSucceeded,
+			ReferenceId:         result.ReferenceId,
+		}).Error
+	})
+}
+
+// transfer yang gagal tetap dicatat, deadlock dan lock timeout yang masih terjadi setelah retry dicoba lagi di putaran berikutnya
+func (s *TransferScheduler) fail(ctx context.Context, scheduled *model.ScheduledTransfer, now time.Time, cause error) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if isRetryable(cause) {
+			return tx.Model(&model.ScheduledTransfer{}).Where("id = ? AND claimed_by = ?", scheduled.ID, scheduled.ClaimedBy).
+				Updates(map[string]interface{}{"claimed_by": "", "claimed_until": nil, "last_error": cause.Error()}).Error
+		}
+
+		err := s.advance(tx, scheduled, now, cause.Error())
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&model.ScheduledTransferRun{
+			ScheduledTransferId: scheduled.ID,
+			ScheduledAt:         scheduled.NextRunAt,
+			Status:              RunFailed,
+			FailureReason:       cause.Error(),
+		}).Error
+	})
+}
+
+// pindahkan next_run_at ke jadwal berikutnya setelah now dan lepas claim
+// jadwal yang terlewat saat runner mati tidak dieksekusi ulang
+func (s *TransferScheduler) advance(tx *gorm.DB, scheduled *model.ScheduledTransfer, now time.Time, lastError string) error {
+	schedule, err := ParseSchedule(scheduled.Schedule)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"last_run_at":   now,
+		"last_error":    lastError,
+		"claimed_by":    "",
+		"claimed_until": nil,
+	}
+
+	next, recurring := schedule.Next(scheduled.NextRunAt)
+	for recurring && !next.After(now) {
+		next, _ = schedule.Next(next)
+	}
+	if recurring {
+		updates["next_run_at"] = next
+	} else {
+		updates["status"] = ScheduleCompleted
+	}
+
+	result := tx.Model(&model.ScheduledTransfer{}).Where("id = ? AND claimed_by = ?", scheduled.ID, scheduled.ClaimedBy).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errClaimLost
+	}
+	return nil
+}
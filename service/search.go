@@ -0,0 +1,447 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+type SearchMode int
+
+const (
+	// kata dicari tanpa operator, hasil diurutkan berdasarkan relevansi
+	SearchNaturalLanguage SearchMode = iota
+	// sintaks boolean MySQL: +wajib -dilarang prefix* "frasa"
+	SearchBoolean
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+	snippetWidth          = 80
+)
+
+var (
+	ErrEmptySearchQuery   = errors.New("kata pencarian tidak boleh kosong")
+	ErrInvalidSearchQuery = errors.New("kata pencarian harus punya minimal satu kata yang tidak dilarang")
+)
+
+type SearchQuery struct {
+	Text     string
+	Mode     SearchMode
+	Page     int
+	PageSize int
+}
+
+type SearchHit struct {
+	Id    uint
+	Title string
+	// potongan teks yang sudah di escape HTML, kata yang cocok dibungkus <mark></mark>
+	Snippet string
+	// semakin besar semakin relevan
+	Score float64
+}
+
+type SearchResult struct {
+	Hits     []SearchHit
+	Total    int64
+	Page     int
+	PageSize int
+}
+
+type SearchService struct {
+	DB *gorm.DB
+}
+
+func NewSearchService(db *gorm.DB) *SearchService {
+	return &SearchService{DB: db}
+}
+
+// siapkan table FTS5 untuk SQLite yang disinkronkan dengan trigger
+// index FULLTEXT MySQL sudah dibuat di database.sql, jadi di MySQL tidak melakukan apa-apa
+func SetupSearch(db *gorm.DB) error {
+	if db.Dialector.Name() != "sqlite" {
+		return nil
+	}
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS todos_fts USING fts5(title, description, content='todos', content_rowid='id')`,
+		`CREATE TRIGGER IF NOT EXISTS todos_fts_insert AFTER INSERT ON todos BEGIN
+			INSERT INTO todos_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS todos_fts_delete AFTER DELETE ON todos BEGIN
+			INSERT INTO todos_fts(todos_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS todos_fts_update AFTER UPDATE OF title, description ON todos BEGIN
+			INSERT INTO todos_fts(todos_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+			INSERT INTO todos_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+		END`,
+		`INSERT INTO todos_fts(todos_fts) VALUES ('rebuild')`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS guest_books_fts USING fts5(message, content='guest_books', content_rowid='id')`,
+		`CREATE TRIGGER IF NOT EXISTS guest_books_fts_insert AFTER INSERT ON guest_books BEGIN
+			INSERT INTO guest_books_fts(rowid, message) VALUES (new.id, new.message);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS guest_books_fts_delete AFTER DELETE ON guest_books BEGIN
+			INSERT INTO guest_books_fts(guest_books_fts, rowid, message) VALUES ('delete', old.id, old.message);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS guest_books_fts_update AFTER UPDATE OF message ON guest_books BEGIN
+			INSERT INTO guest_books_fts(guest_books_fts, rowid, message) VALUES ('delete', old.id, old.message);
+			INSERT INTO guest_books_fts(rowid, message) VALUES (new.id, new.message);
+		END`,
+		`INSERT INTO guest_books_fts(guest_books_fts) VALUES ('rebuild')`,
+	}
+	for _, statement := range statements {
+		err := db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type searchTerm struct {
+	Word     string
+	Operator byte
+	Prefix   bool
+	Phrase   bool
+}
+
+// pecah kata pencarian, karakter selain huruf dan angka dibuang supaya tidak bisa menyisipkan sintaks
+func parseSearchTerms(text string, mode SearchMode) []searchTerm {
+	var terms []searchTerm
+	clean := func(word string) string {
+		return strings.Join(strings.FieldsFunc(strings.Map(unicode.ToLower, word), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}), " ")
+	}
+
+	for len(text) > 0 {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			break
+		}
+
+		term := searchTerm{}
+		if mode == SearchBoolean && (text[0] == '+' || text[0] == '-') {
+			term.Operator = text[0]
+			text = text[1:]
+		}
+
+		var raw string
+		if mode == SearchBoolean && strings.HasPrefix(text, `"`) {
+			end := strings.Index(text[1:], `"`)
+			if end < 0 {
+				raw, text = text[1:], ""
+			} else {
+				raw, text = text[1:end+1], text[end+2:]
+			}
+			term.Phrase = true
+		} else {
+			end := strings.IndexFunc(text, unicode.IsSpace)
+			if end < 0 {
+				end = len(text)
+			}
+			raw, text = text[:end], text[end:]
+			term.Prefix = mode == SearchBoolean && strings.HasSuffix(raw, "*")
+		}
+
+		term.Word = clean(raw)
+		if term.Word == "" {
+			continue
+		}
+		// kata biasa yang mengandung tanda baca dipecah menjadi beberapa kata
+		if !term.Phrase && strings.Contains(term.Word, " ") {
+			words := strings.Fields(term.Word)
+			for i, word := range words {
+				terms = append(terms, searchTerm{Word: word, Operator: term.Operator, Prefix: term.Prefix && i == len(words)-1})
+			}
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// kata pencarian untuk MATCH ... AGAINST
+func mysqlSearchQuery(terms []searchTerm, mode SearchMode) string {
+	var parts []string
+	for _, term := range terms {
+		if mode == SearchNaturalLanguage {
+			parts = append(parts, term.Word)
+			continue
+		}
+
+		part := term.Word
+		if term.Phrase {
+			part = `"` + part + `"`
+		}
+		if term.Operator != 0 {
+			part = string(term.Operator) + part
+		}
+		if term.Prefix {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// kata pencarian untuk FTS5 MATCH dengan arti yang sama seperti mode boolean MySQL
+// kata wajib digabung AND, kata opsional digabung OR jika tidak ada kata wajib, kata dilarang memakai NOT
+func ftsSearchQuery(terms []searchTerm) string {
+	var required, optional, excluded []string
+	for _, term := range terms {
+		part := `"` + term.Word + `"`
+		if term.Prefix {
+			part += "*"
+		}
+
+		switch term.Operator {
+		case '+':
+			required = append(required, part)
+		case '-':
+			excluded = append(excluded, part)
+		default:
+			optional = append(optional, part)
+		}
+	}
+
+	query := strings.Join(required, " AND ")
+	if query == "" {
+		query = "(" + strings.Join(optional, " OR ") + ")"
+	}
+	for _, part := range excluded {
+		query += " NOT " + part
+	}
+	return query
+}
+
+// mode boolean tanpa kata yang wajib atau opsional tidak akan pernah cocok dengan apapun
+func validateSearchTerms(terms []searchTerm) error {
+	for _, term := range terms {
+		if term.Operator != '-' {
+			return nil
+		}
+	}
+	return ErrInvalidSearchQuery
+}
+
+func (q SearchQuery) pagination() (int, int) {
+	page, pageSize := q.Page, q.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultSearchPageSize
+	}
+	if pageSize > maxSearchPageSize {
+		pageSize = maxSearchPageSize
+	}
+	return page, pageSize
+}
+
+type searchRow struct {
+	Id    uint
+	Title string
+	Body  string
+	Score float64
+}
+
+// definisi table yang bisa dicari
+type searchSource struct {
+	Table      string
+	FTSTable   string
+	Columns    []string
+	TitleExpr  string
+	BodyExpr   string
+	Conditions func(db *gorm.DB) *gorm.DB
+}
+
+func (s *SearchService) search(ctx context.Context, source searchSource, query SearchQuery) (*SearchResult, error) {
+	terms := parseSearchTerms(query.Text, query.Mode)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearchQuery
+	}
+
+	err := validateSearchTerms(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	page, pageSize := query.pagination()
+	result := &SearchResult{Hits: []SearchHit{}, Page: page, PageSize: pageSize}
+
+	var base *gorm.DB
+	var score string
+	var args []interface{}
+	tx := s.DB.WithContext(ctx)
+	if tx.Dialector.Name() == "sqlite" {
+		base = tx.Table(source.FTSTable).
+			Joins("JOIN "+source.Table+" ON "+source.Table+".id = "+source.FTSTable+".rowid").
+			Where(source.FTSTable+" MATCH ?", ftsSearchQuery(terms))
+		// bm25 bernilai negatif, semakin kecil semakin relevan
+		score = "-bm25(" + source.FTSTable + ")"
+	} else {
+		columns := strings.Join(source.Columns, ", ")
+		score = "MATCH(" + columns + ") AGAINST (? IN NATURAL LANGUAGE MODE)"
+		if query.Mode == SearchBoolean {
+			score = "MATCH(" + columns + ") AGAINST (? IN BOOLEAN MODE)"
+		}
+		match := mysqlSearchQuery(terms, query.Mode)
+		base = tx.Table(source.Table).Where(score, match)
+		args = append(args, match)
+	}
+
+	base = base.Where(source.Table + ".deleted_at IS NULL")
+	if source.Conditions != nil {
+		base = base.Scopes(source.Conditions)
+	}
+
+	var rows []searchRow
+	err = base.Session(&gorm.Session{}).
+		Select(source.Table+".id AS id, "+source.TitleExpr+" AS title, "+source.BodyExpr+" AS body, "+score+" AS score", args...).
+		Order("score desc, " + source.Table + ".id desc").
+		Limit(pageSize).Offset((page - 1) * pageSize).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = base.Session(&gorm.Session{}).Count(&result.Total).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		// snippet dibuat sendiri supaya teks di escape dengan cara yang sama di MySQL dan SQLite
+		snippet, found := highlight(row.Body, terms, snippetWidth)
+		if !found {
+			snippet, _ = highlight(row.Title, terms, snippetWidth)
+		}
+		result.Hits = append(result.Hits, SearchHit{Id: row.Id, Title: row.Title, Snippet: snippet, Score: row.Score})
+	}
+	return result, nil
+}
+
+// cari todo yang bisa dilihat user berdasarkan title dan description
+func (s *SearchService) SearchTodos(ctx context.Context, userId string, query SearchQuery) (*SearchResult, error) {
+	return s.search(ctx, searchSource{
+		Table:      "todos",
+		FTSTable:   "todos_fts",
+		Columns:    []string{"todos.title", "todos.description"},
+		TitleExpr:  "todos.title",
+		BodyExpr:   "coalesce(todos.description, '')",
+		Conditions: VisibleTo(userId),
+	}, query)
+}
+
+// cari pesan buku tamu
+func (s *SearchService) SearchGuestBooks(ctx context.Context, query SearchQuery) (*SearchResult, error) {
+	return s.search(ctx, searchSource{
+		Table:     "guest_books",
+		FTSTable:  "guest_books_fts",
+		Columns:   []string{"guest_books.message"},
+		TitleExpr: "guest_books.name",
+		BodyExpr:  "coalesce(guest_books.message, '')",
+	}, query)
+}
+
+// potong teks di sekitar kata pertama yang cocok dan bungkus semua kata yang cocok dengan <mark></mark>
+// teks berasal dari user, jadi setiap potongan di escape supaya aman ditampilkan sebagai HTML
+func highlight(text string, terms []searchTerm, width int) (string, bool) {
+	runes := []rune(text)
+
+	type match struct{ start, end int }
+	var matches []match
+	for i := 0; i < len(runes); i++ {
+		for _, term := range terms {
+			if term.Operator == '-' {
+				continue
+			}
+			end, ok := matchTerm(runes, i, term)
+			if !ok {
+				continue
+			}
+			matches = append(matches, match{i, end})
+			i = end - 1
+			break
+		}
+	}
+
+	start := 0
+	if len(matches) > 0 && matches[0].start > width/2 {
+		start = matches[0].start - width/2
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+	position := start
+	for _, m := range matches {
+		if m.start < start || m.end > end {
+			continue
+		}
+		snippet.WriteString(html.EscapeString(string(runes[position:m.start])))
+		snippet.WriteString("<mark>" + html.EscapeString(string(runes[m.start:m.end])) + "</mark>")
+		position = m.end
+	}
+	snippet.WriteString(html.EscapeString(string(runes[position:end])))
+	if end < len(runes) {
+		snippet.WriteString("…")
+	}
+	return snippet.String(), len(matches) > 0
+}
+
+// cocokkan kata di posisi start tanpa membedakan huruf besar kecil, dibandingkan per rune
+// supaya posisinya tetap sama dengan teks asli
+// kata harus dimulai di awal kata, dan berakhir di akhir kata kecuali prefix
+func matchTerm(runes []rune, start int, term searchTerm) (int, bool) {
+	if start > 0 && isWordRune(runes[start-1]) {
+		return 0, false
+	}
+
+	word := []rune(term.Word)
+	if start+len(word) > len(runes) {
+		return 0, false
+	}
+	for i, r := range word {
+		if !equalFold(runes[start+i], r) {
+			return 0, false
+		}
+	}
+
+	end := start + len(word)
+	if term.Prefix {
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+	} else if end < len(runes) && isWordRune(runes[end]) {
+		return 0, false
+	}
+	return end, true
+}
+
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+)
+
+var ErrInvalidPeriod = errors.New("tanggal akhir harus setelah tanggal awal")
+
+type StatementLine struct {
+	EntryId       int64     `json:"entry_id"`
+	Time          time.Time `json:"time"`
+	Amount        int64     `json:"amount"`
+	BalanceAfter  int64     `json:"balance_after"`
+	ReferenceType string    `json:"reference_type"`
+	ReferenceId   string    `json:"reference_id"`
+}
+
+// mutasi wallet dalam periode [From, To)
+// semua waktu ditampilkan di zona waktu milik From
+type WalletStatement struct {
+	WalletId       string          `json:"wallet_id"`
+	Currency       string          `json:"currency"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance int64           `json:"opening_balance"`
+	ClosingBalance int64           `json:"closing_balance"`
+	TotalCredit    int64           `json:"total_credit"`
+	TotalDebit     int64           `json:"total_debit"`
+	Lines          []StatementLine `json:"lines"`
+}
+
+func (s *WalletService) Statement(ctx context.Context, walletId string, from time.Time, to time.Time) (*WalletStatement, error) {
+	if !from.Before(to) {
+		return nil, ErrInvalidPeriod
+	}
+
+	tx := s.DB.WithContext(ctx)
+	var wallet model.Wallet
+	err := tx.Unscoped().Take(&wallet, "id = ?", walletId).Error
+	if err != nil {
+		return nil, err
+	}
+
+	location := from.Location()
+	statement := &WalletStatement{
+		WalletId: walletId,
+		Currency: wallet.Currency,
+		From:     from,
+		To:       to.In(location),
+		Lines:    []StatementLine{},
+	}
+
+	// saldo awal diambil dari balance_after entry terakhir sebelum periode
+	var last model.WalletEntry
+	err = tx.Where("wallet_id = ? AND created_at < ?", walletId, from).Order("created_at desc, id desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	statement.OpeningBalance = last.BalanceAfter.Amount
+	statement.ClosingBalance = last.BalanceAfter.Amount
+
+	// from dan to dikirim sebagai time.Time, driver mysql (loc=Local) yang mengkonversi zona waktunya
+	var entries []model.WalletEntry
+	err = tx.Where("wallet_id = ? AND created_at >= ? AND created_at < ?", walletId, from, to).Order("created_at asc, id asc").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		statement.Lines = append(statement.Lines, StatementLine{
+			EntryId:       entry.ID,
+			Time:          entry.CreatedAt.In(location),
+			Amount:        entry.Amount.Amount,
+			BalanceAfter:  entry.BalanceAfter.Amount,
+			ReferenceType: entry.ReferenceType,
+			ReferenceId:   entry.ReferenceId,
+		})
+
+		amount := entry.Amount.Amount
+		if amount > 0 {
+			statement.TotalCredit += amount
+		} else {
+			statement.TotalDebit += -amount
+		}
+		statement.ClosingBalance += amount
+	}
+
+	return statement, nil
+}
+
+func (s *WalletStatement) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+func (s *WalletStatement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"entry_id", "time", "amount", "balance_after", "reference_type", "reference_id"})
+	if err != nil {
+		return err
+	}
+
+	for _, line := range s.Lines {
+		err = writer.Write([]string{
+			strconv.FormatInt(line.EntryId, 10),
+			line.Time.Format(time.RFC3339),
+			strconv.FormatInt(line.Amount, 10),
+			strconv.FormatInt(line.BalanceAfter, 10),
+			line.ReferenceType,
+			line.ReferenceId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *WalletStatement) WriteText(w io.Writer) error {
+	format := func(amount int64) string {
+		return money.New(amount, s.Currency).String()
+	}
+
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Wallet\t%s\n", s.WalletId)
+	fmt.Fprintf(writer, "Periode\t%s - %s\n", s.From.Format("2006-01-02 15:04 MST"), s.To.Format("2006-01-02 15:04 MST"))
+	fmt.Fprintf(writer, "Saldo awal\t%s\n\n", format(s.OpeningBalance))
+
+	fmt.Fprintln(writer, "Waktu\tKeterangan\tJumlah\tSaldo")
+	for _, line := range s.Lines {
+		fmt.Fprintf(writer, "%s\t%s %s\t%s\t%s\n", line.Time.Format("2006-01-02 15:04:05"), line.ReferenceType, line.ReferenceId, format(line.Amount), format(line.BalanceAfter))
+	}
+
+	fmt.Fprintf(writer, "\nTotal credit\t%s\n", format(s.TotalCredit))
+	fmt.Fprintf(writer, "Total debit\t%s\n", format(s.TotalDebit))
+	fmt.Fprintf(writer, "Saldo akhir\t%s\n", format(s.ClosingBalance))
+	return writer.Flush()
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTagExists        = errors.New("tag dengan nama tersebut sudah ada, gunakan merge")
+	ErrTagOwnerMismatch = errors.New("tag milik user yang berbeda")
+	ErrEmptyTagName     = errors.New("nama tag tidak boleh kosong")
+)
+
+func normalizeTagNames(names []string) ([]string, error) {
+	var result []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, ErrEmptyTagName
+		}
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// ambil tag milik user, tag yang belum ada dibuat
+func findOrCreateTags(tx *gorm.DB, userId string, names []string) ([]model.Tag, error) {
+	var tags []model.Tag
+	for _, name := range names {
+		tags = append(tags, model.Tag{UserId: userId, Name: name})
+	}
+
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// id tag yang sudah ada tidak terisi oleh insert di atas, jadi diambil ulang
+	tags = nil
+	err = tx.Where("user_id = ? AND name IN ?", userId, names).Order("name asc").Find(&tags).Error
+	return tags, err
+}
+
+// tambahkan tag ke todo, tag dibuat untuk pemilik todo jika belum ada
+// hanya pemilik dan editor yang boleh, sama seperti Untag
+func (s *TodoService) Tag(ctx context.Context, todoId uint, actorId string, names ...string) error {
+	names, err := normalizeTagNames(names)
+	if err != nil || len(names) == 0 {
+		return err
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx, todoId, actorId, todoEditors...)
+		if err != nil {
+			return err
+		}
+
+		tags, err := findOrCreateTags(tx, todo.UserId, names)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(todo).Association("Tags").Append(&tags)
+	})
+}
+
+// lepas tag dari todo, tagnya sendiri tidak dihapus
+func (s *TodoService) Untag(ctx context.Context, todoId uint, actorId string, names ...string) error {
+	names, err := normalizeTagNames(names)
+	if err != nil || len(names) == 0 {
+		return err
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx, todoId, actorId, todoEditors...)
+		if err != nil {
+			return err
+		}
+
+		var tags []model.Tag
+		err = tx.Where("user_id = ? AND name IN ?", todo.UserId, names).Find(&tags).Error
+		if err != nil || len(tags) == 0 {
+			return err
+		}
+
+		return tx.Model(todo).Association("Tags").Delete(&tags)
+	})
+}
+
+// ganti nama tag, jika nama baru sudah dipakai tag lain gunakan MergeTags
+// hanya pemilik tag yang boleh
+func (s *TodoService) RenameTag(ctx context.Context, tagId int64, name string, actorId string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrEmptyTagName
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var tag model.Tag
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&tag, "id = ?", tagId).Error
+		if err != nil {
+			return err
+		}
+		if tag.UserId != actorId {
+			return ErrTagOwnerMismatch
+		}
+
+		var count int64
+		err = tx.Model(&model.Tag{}).Where("user_id = ? AND name = ? AND id <> ?", tag.UserId, name, tag.ID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrTagExists
+		}
+
+		return tx.Model(&tag).Update("name", name).Error
+	})
+}
+
+// gabungkan tag source ke target, todo yang punya source akan punya target lalu source dihapus
+// kedua tag harus milik actor
+func (s *TodoService) MergeTags(ctx context.Context, sourceId int64, targetId int64, actorId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var tags []model.Tag
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", []int64{sourceId, targetId}).Find(&tags).Error
+		if err != nil {
+			return err
+		}
+		if len(tags) != 2 {
+			return gorm.ErrRecordNotFound
+		}
+		if tags[0].UserId != actorId || tags[1].UserId != actorId {
+			return ErrTagOwnerMismatch
+		}
+
+		return mergeTag(tx, sourceId, targetId)
+	})
+}
+
+// pindahkan todo_tags dari source ke target lalu hapus source
+func mergeTag(tx *gorm.DB, sourceId int64, targetId int64) error {
+	// todo yang sudah punya target cukup dilepas dari source
+	err := tx.Exec("UPDATE todo_tags SET tag_id = ? WHERE tag_id = ? AND todo_id NOT IN (SELECT todo_id FROM (SELECT todo_id FROM todo_tags WHERE tag_id = ?) AS tagged)", targetId, sourceId, targetId).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Exec("DELETE FROM todo_tags WHERE tag_id = ?", sourceId).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Delete(&model.Tag{}, "id = ?", sourceId).Error
+}
+
+// todo milik user yang punya minimal satu dari tag names
+func (s *TodoService) TodosWithAnyTag(ctx context.Context, userId string, names ...string) ([]model.Todo, error) {
+	return s.todosByTags(ctx, userId, names, false)
+}
+
+// todo milik user yang punya semua tag names
+func (s *TodoService) TodosWithAllTags(ctx context.Context, userId string, names ...string) ([]model.Todo, error) {
+	return s.todosByTags(ctx, userId, names, true)
+}
+
+func (s *TodoService) todosByTags(ctx context.Context, userId string, names []string, all bool) ([]model.Todo, error) {
+	names, err := normalizeTagNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	todos := []model.Todo{}
+	if len(names) == 0 {
+		return todos, nil
+	}
+
+	tx := s.DB.WithContext(ctx)
+	tagged := tx.Table("todo_tags").Select("todo_tags.todo_id").
+		Joins("JOIN tags ON tags.id = todo_tags.tag_id").
+		Where("tags.user_id = ? AND tags.name IN ?", userId, names).
+		Group("todo_tags.todo_id")
+	if all {
+		tagged = tagged.Having("count(distinct tags.id) = ?", len(names))
+	}
+
+	err = tx.Preload("Tags").Where("user_id = ? AND id IN (?)", userId, tagged).Order("id asc").Find(&todos).Error
+	return todos, err
+}
+
+type TagUsage struct {
+	TagId int64
+	Name  string
+	Todos int64
+}
+
+// jumlah todo aktif per tag milik user, tag yang belum dipakai tetap ditampilkan
+func (s *TodoService) TagUsage(ctx context.Context, userId string) ([]TagUsage, error) {
+	var usage []TagUsage
+	err := s.DB.WithContext(ctx).Model(&model.Tag{}).
+		Select("tags.id as tag_id, tags.name as name, count(todos.id) as todos").
+		Joins("LEFT JOIN todo_tags ON todo_tags.tag_id = tags.id").
+		Joins("LEFT JOIN todos ON todos.id = todo_tags.todo_id AND todos.deleted_at IS NULL").
+		Where("tags.user_id = ?", userId).
+		Group("tags.id, tags.name").
+		Order("todos desc, name asc").
+		Scan(&usage).Error
+	return usage, err
+}
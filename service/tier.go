@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidTierRange = errors.New("min balance tier tidak boleh lebih besar dari max balance")
+	ErrTierOverlap      = errors.New("rentang balance tier bertabrakan dengan tier lain")
+)
+
+// scope wallet berdasarkan tier di table wallet_tiers, pengganti BrokeWalletBalance dan SultanWalletBalance
+// query harus dari table wallets
+func Tier(name string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("EXISTS (SELECT 1 FROM wallet_tiers WHERE wallet_tiers.name = ? AND wallets.balance >= wallet_tiers.min_balance AND (wallet_tiers.max_balance IS NULL OR wallets.balance <= wallet_tiers.max_balance))", name)
+	}
+}
+
+// simpan tier baru atau ubah tier dengan nama yang sama
+// rentang balance tidak boleh bertabrakan dengan tier lain supaya setiap balance punya tepat satu tier
+func (s *WalletService) SaveTier(ctx context.Context, tier *model.WalletTier) error {
+	if tier.MaxBalance != nil && tier.MinBalance > *tier.MaxBalance {
+		return ErrInvalidTierRange
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		overlap := tx.Model(&model.WalletTier{}).Where("name <> ?", tier.Name).
+			Where("max_balance IS NULL OR max_balance >= ?", tier.MinBalance)
+		if tier.MaxBalance != nil {
+			overlap = overlap.Where("min_balance <= ?", *tier.MaxBalance)
+		}
+
+		var count int64
+		err := overlap.Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrTierOverlap
+		}
+
+		var existing model.WalletTier
+		err = tx.Where("name = ?", tier.Name).Limit(1).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		if existing.ID == 0 {
+			return tx.Create(tier).Error
+		}
+
+		tier.ID = existing.ID
+		return tx.Model(&existing).Updates(map[string]interface{}{
+			"min_balance": tier.MinBalance,
+			"max_balance": tier.MaxBalance,
+		}).Error
+	})
+}
+
+// nama tier untuk balance, string kosong jika tidak masuk tier manapun
+func tierOf(tx *gorm.DB, balance int64) (string, error) {
+	var names []string
+	err := tx.Model(&model.WalletTier{}).
+		Where("min_balance <= ? AND (max_balance IS NULL OR max_balance >= ?)", balance, balance).
+		Order("min_balance desc").Limit(1).Pluck("name", &names).Error
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return names[0], nil
+}
+
+// catat perpindahan tier jika balance wallet berubah melewati batas tier
+func recordTierChange(tx *gorm.DB, wallet *model.Wallet, before int64, after int64) error {
+	from, err := tierOf(tx, before)
+	if err != nil {
+		return err
+	}
+	to, err := tierOf(tx, after)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+
+	return tx.Create(&model.WalletTierChange{
+		WalletId: wallet.Id,
+		UserId:   wallet.UserId,
+		FromTier: from,
+		ToTier:   to,
+		Balance:  money.New(after, wallet.Currency),
+	}).Error
+}
+
+type TierCount struct {
+	Tier         string
+	Wallets      int64
+	TotalBalance int64
+}
+
+// jumlah wallet dan total balance per tier, tier dengan wallet kurang dari minWallets tidak ditampilkan
+func (s *WalletService) TierDistribution(ctx context.Context, minWallets int64) ([]TierCount, error) {
+	var counts []TierCount
+	err := s.DB.WithContext(ctx).Model(&model.WalletTier{}).
+		Select("wallet_tiers.name as tier, count(wallets.id) as wallets, coalesce(sum(wallets.balance), 0) as total_balance").
+		Joins("LEFT JOIN wallets ON wallets.balance >= wallet_tiers.min_balance AND (wallet_tiers.max_balance IS NULL OR wallets.balance <= wallet_tiers.max_balance) AND wallets.deleted_at IS NULL").
+		Group("wallet_tiers.name, wallet_tiers.min_balance").
+		Having("count(wallets.id) >= ?", minWallets).
+		Order("wallet_tiers.min_balance asc").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// riwayat perpindahan tier dalam periode [from, to)
+func (s *WalletService) TierChanges(ctx context.Context, from time.Time, to time.Time) ([]model.WalletTierChange, error) {
+	if !from.Before(to) {
+		return nil, ErrInvalidPeriod
+	}
+
+	var changes []model.WalletTierChange
+	err := s.DB.WithContext(ctx).Where("created_at >= ? AND created_at < ?", from, to).
+		Order("created_at asc, id asc").Find(&changes).Error
+	return changes, err
+}
+
+type TierMovement struct {
+	FromTier string
+	ToTier   string
+	Users    int64
+}
+
+// jumlah user yang pindah dari satu tier ke tier lain dalam periode [from, to)
+func (s *WalletService) TierMovements(ctx context.Context, from time.Time, to time.Time) ([]TierMovement, error) {
+	if !from.Before(to) {
+		return nil, ErrInvalidPeriod
+	}
+
+	var movements []TierMovement
+	err := s.DB.WithContext(ctx).Model(&model.WalletTierChange{}).
+		Select("from_tier, to_tier, count(distinct user_id) as users").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("from_tier, to_tier").
+		Order("users desc, from_tier asc, to_tier asc").
+		Scan(&movements).Error
+	return movements, err
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTodoNotTrashed  = errors.New("todo tidak ada di tempat sampah")
+	ErrTodoHasSubtasks = errors.New("todo masih punya subtask yang belum dihapus")
+)
+
+// parent_id yang masih punya subtask aktif dari daftar id, dibungkus derived table supaya MySQL
+// mengizinkan subquery ke table yang sama di dalam DELETE
+// todo seperti ini tidak boleh dihapus permanen karna foreign key parent_id ON DELETE CASCADE
+// akan ikut menghapus subtask aktifnya
+const liveParentsQuery = `SELECT parent_id FROM (
+	SELECT parent_id FROM todos WHERE parent_id IN ? AND deleted_at IS NULL
+) AS live_parents`
+
+type TodoService struct {
+	DB *gorm.DB
+}
+
+func NewTodoService(db *gorm.DB) *TodoService {
+	return &TodoService{DB: db}
+}
+
+// todo milik user yang sudah di soft delete, yang terakhir dihapus paling atas
+func (s *TodoService) ListTrashed(ctx context.Context, userId string) ([]model.Todo, error) {
+	var todos []model.Todo
+	err := s.DB.WithContext(ctx).Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userId).
+		Order("deleted_at desc, id desc").Find(&todos).Error
+	return todos, err
+}
+
+// kembalikan todo dari tempat sampah beserta subtask yang ikut terhapus bersamanya
+// hanya pemilik yang boleh
+func (s *TodoService) Restore(ctx context.Context, id uint, actorId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx.Unscoped().Session(&gorm.Session{}), id, actorId, TodoOwner)
+		if err != nil {
+			return err
+		}
+		if !todo.DeletedAt.Valid {
+			return ErrTodoNotTrashed
+		}
+
+		// subtask yang dihapus terpisah sebelumnya (deleted_at berbeda) tetap di tempat sampah
+		return tx.Exec(`UPDATE todos SET deleted_at = NULL, updated_at = ? WHERE deleted_at = ? AND id IN (
+			SELECT id FROM (
+				WITH RECURSIVE subtree AS (
+					SELECT id FROM todos WHERE id = ?
+					UNION
+					SELECT todos.id FROM todos JOIN subtree ON todos.parent_id = subtree.id
+				)
+				SELECT id FROM subtree
+			) AS restored
+		)`, time.Now(), todo.DeletedAt.Time, todo.ID).Error
+	})
+}
+
+// hapus permanen todo yang sudah ada di tempat sampah, hanya pemilik yang boleh
+func (s *TodoService) Purge(ctx context.Context, id uint, actorId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx.Unscoped().Session(&gorm.Session{}), id, actorId, TodoOwner)
+		if err != nil {
+			return err
+		}
+		if !todo.DeletedAt.Valid {
+			return ErrTodoNotTrashed
+		}
+
+		var live int64
+		err = tx.Model(&model.Todo{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("parent_id = ?", todo.ID).Count(&live).Error
+		if err != nil {
+			return err
+		}
+		if live > 0 {
+			return ErrTodoHasSubtasks
+		}
+
+		return tx.Unscoped().Where("id = ?", todo.ID).Delete(&model.Todo{}).Error
+	})
+}
+
+type PurgeReport struct {
+	Batches int
+	Purged  int64
+}
+
+// hapus permanen todo yang sudah di soft delete lebih lama dari retention
+// dihapus per batch supaya tidak mengunci table terlalu lama
+// todo yang masih punya subtask aktif dilewati sampai subtasknya ikut dihapus
+func (s *TodoService) PurgeTrash(ctx context.Context, retention time.Duration, batchSize int) (*PurgeReport, error) {
+	cutoff := time.Now().Add(-retention)
+	report := &PurgeReport{}
+
+	for {
+		var ids []uint
+		err := s.DB.WithContext(ctx).Unscoped().Model(&model.Todo{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM todos AS subtasks WHERE subtasks.parent_id = todos.id AND subtasks.deleted_at IS NULL)").
+			Order("id asc").Limit(batchSize).Pluck("id", &ids).Error
+		if err != nil {
+			return report, err
+		}
+		if len(ids) == 0 {
+			return report, nil
+		}
+
+		// deleted_at dan subtask dicek ulang, todo atau subtasknya bisa saja sudah di restore setelah diambil
+		result := s.DB.WithContext(ctx).Unscoped().
+			Where("id IN ? AND deleted_at IS NOT NULL AND deleted_at < ?", ids, cutoff).
+			Where("id NOT IN ("+liveParentsQuery+")", ids).Delete(&model.Todo{})
+		if result.Error != nil {
+			return report, result.Error
+		}
+
+		report.Batches++
+		report.Purged += result.RowsAffected
+		if len(ids) < batchSize {
+			return report, nil
+		}
+	}
+}
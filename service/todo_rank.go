@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/rank"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrRankAnchorNotFound = errors.New("todo acuan tidak ada di list user")
+
+// panjang rank maksimal sebelum list user perlu di rebalance
+var MaxRankLength = 16
+
+// urutkan todo sesuai urutan manual user
+func ByRank(db *gorm.DB) *gorm.DB {
+	return db.Order("rank_key asc").Order("id asc")
+}
+
+type rankedTodo struct {
+	ID     uint
+	UserId string
+	Rank   string `gorm:"column:rank_key"`
+}
+
+// lock semua todo milik user supaya perpindahan urutan oleh user yang sama berjalan bergantian
+func lockRanks(tx *gorm.DB, userId string) ([]rankedTodo, error) {
+	var todos []rankedTodo
+	err := tx.Model(&model.Todo{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id, user_id, rank_key").Where("user_id = ?", userId).Scopes(ByRank).Find(&todos).Error
+	return todos, err
+}
+
+// beri rank baru yang tersebar merata ke semua todo user, urutannya tidak berubah
+func rebalance(tx *gorm.DB, todos []rankedTodo) error {
+	keys := rank.Spread(len(todos))
+	for i := range todos {
+		if todos[i].Rank == keys[i] {
+			continue
+		}
+		err := tx.Model(&model.Todo{}).Where("id = ?", todos[i].ID).UpdateColumn("rank_key", keys[i]).Error
+		if err != nil {
+			return err
+		}
+		todos[i].Rank = keys[i]
+	}
+	return nil
+}
+
+// pindahkan todo ke posisi dalam list user (tanpa todo itu sendiri), hanya satu baris yang diubah
+// kecuali rank tetangganya kosong atau kembar, list di rebalance dulu
+// urutan adalah list milik pemilik todo, jadi hanya pemilik yang boleh
+// list actor di lock dulu sebelum cek role, supaya urutan lock sama dengan perpindahan lain dan tidak deadlock
+func (s *TodoService) moveTo(ctx context.Context, todoId uint, actorId string, position func(others []rankedTodo) (int, error)) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todos, err := lockRanks(tx, actorId)
+		if err != nil {
+			return err
+		}
+
+		_, err = authorizeTodo(tx, todoId, actorId, TodoOwner)
+		if err != nil {
+			return err
+		}
+
+		var others []rankedTodo
+		for _, item := range todos {
+			if item.ID != todoId {
+				others = append(others, item)
+			}
+		}
+
+		index, err := position(others)
+		if err != nil {
+			return err
+		}
+
+		for attempt := 0; attempt < 2; attempt++ {
+			before, after := "", ""
+			if index > 0 {
+				before = others[index-1].Rank
+			}
+			if index < len(others) {
+				after = others[index].Rank
+			}
+
+			// rank kosong hanya boleh jadi batas akhir list
+			key, err := rank.Between(before, after)
+			if err == nil && (index == len(others) || after != "") {
+				return tx.Model(&model.Todo{}).Where("id = ?", todoId).UpdateColumn("rank_key", key).Error
+			}
+
+			err = rebalance(tx, others)
+			if err != nil {
+				return err
+			}
+		}
+		return rank.ErrInvalidRange
+	})
+}
+
+// posisi todo anchorId dalam list, ditambah offset (0 sebelum, 1 sesudah)
+func anchorPosition(others []rankedTodo, anchorId uint, offset int) (int, error) {
+	for i, item := range others {
+		if item.ID == anchorId {
+			return i + offset, nil
+		}
+	}
+	return 0, ErrRankAnchorNotFound
+}
+
+// taruh todo tepat sebelum todo beforeId
+func (s *TodoService) MoveBefore(ctx context.Context, todoId uint, beforeId uint, actorId string) error {
+	return s.moveTo(ctx, todoId, actorId, func(others []rankedTodo) (int, error) {
+		return anchorPosition(others, beforeId, 0)
+	})
+}
+
+// taruh todo tepat setelah todo afterId
+func (s *TodoService) MoveAfter(ctx context.Context, todoId uint, afterId uint, actorId string) error {
+	return s.moveTo(ctx, todoId, actorId, func(others []rankedTodo) (int, error) {
+		return anchorPosition(others, afterId, 1)
+	})
+}
+
+func (s *TodoService) MoveToTop(ctx context.Context, todoId uint, actorId string) error {
+	return s.moveTo(ctx, todoId, actorId, func(others []rankedTodo) (int, error) {
+		return 0, nil
+	})
+}
+
+// rebalance list user yang ranknya terlalu panjang, kosong (data lama) atau kembar
+// aman dijalankan bersamaan dengan perpindahan karna memakai lock yang sama
+func (s *TodoService) RebalanceRanks(ctx context.Context) (int, error) {
+	tx := s.DB.WithContext(ctx)
+
+	var long []string
+	err := tx.Model(&model.Todo{}).Distinct("user_id").
+		Where("length(rank_key) > ? OR rank_key = ''", MaxRankLength).Pluck("user_id", &long).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var duplicated []string
+	err = tx.Model(&model.Todo{}).Select("user_id").Group("user_id, rank_key").Having("count(*) > 1").Pluck("user_id", &duplicated).Error
+	if err != nil {
+		return 0, err
+	}
+
+	rebalanced := 0
+	seen := map[string]bool{}
+	for _, userId := range append(long, duplicated...) {
+		if seen[userId] {
+			continue
+		}
+		seen[userId] = true
+
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			todos, err := lockRanks(tx, userId)
+			if err != nil {
+				return err
+			}
+			return rebalance(tx, todos)
+		})
+		if err != nil {
+			return rebalanced, err
+		}
+		rebalanced++
+	}
+
+	return rebalanced, nil
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/rrule"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRecurrenceNeedsDueAt = errors.New("todo berulang harus punya due_at")
+	ErrNotRecurring         = errors.New("todo bukan bagian dari seri berulang")
+	ErrRecurrenceEditScope  = errors.New("aturan pengulangan hanya bisa diubah untuk semua occurrence berikutnya")
+	ErrRecurrenceNotRoot    = errors.New("aturan pengulangan occurrence diubah lewat EditOccurrence")
+)
+
+type EditScope int
+
+const (
+	// ubah occurrence ini saja
+	EditThisOccurrence EditScope = iota
+	// ubah occurrence ini dan semua occurrence setelahnya
+	EditAllFuture
+)
+
+// field yang bisa diubah lewat EditOccurrence, nil berarti tidak diubah
+type TodoChanges struct {
+	Title       *string
+	Description *string
+	Priority    *int
+	Recurrence  *string
+}
+
+func (c TodoChanges) fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	if c.Title != nil {
+		fields["title"] = *c.Title
+	}
+	if c.Description != nil {
+		fields["description"] = *c.Description
+	}
+	if c.Priority != nil {
+		fields["priority"] = *c.Priority
+	}
+	return fields
+}
+
+// jadikan todo sebagai awal seri berulang, rule kosong berarti berhenti berulang
+// due_at todo menjadi DTSTART seri, hanya pemilik yang boleh
+func (s *TodoService) SetRecurrence(ctx context.Context, todoId uint, rule string, actorId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx, todoId, actorId, TodoOwner)
+		if err != nil {
+			return err
+		}
+		// occurrence yang diberi aturan sendiri akan membuat seri kedua yang bentrok dengan seri induknya
+		if todo.RecurrenceParentID != nil {
+			return ErrRecurrenceNotRoot
+		}
+
+		if rule != "" {
+			parsed, err := rrule.Parse(rule)
+			if err != nil {
+				return err
+			}
+			if todo.DueAt == nil {
+				return ErrRecurrenceNeedsDueAt
+			}
+			rule = parsed.String()
+		}
+
+		return tx.Model(todo).Update("recurrence", rule).Error
+	})
+}
+
+// todo pertama seri, nil jika todo tidak berulang
+func seriesRoot(tx *gorm.DB, todo *model.Todo) (*model.Todo, error) {
+	if todo.RecurrenceParentID == nil {
+		if todo.Recurrence == "" || todo.DueAt == nil {
+			return nil, nil
+		}
+		return todo, nil
+	}
+
+	var root model.Todo
+	err := tx.Unscoped().Take(&root, "id = ?", *todo.RecurrenceParentID).Error
+	if err != nil {
+		return nil, err
+	}
+	if root.Recurrence == "" || root.DueAt == nil {
+		return nil, nil
+	}
+	return &root, nil
+}
+
+func inSeries(tx *gorm.DB, root *model.Todo) *gorm.DB {
+	return tx.Model(&model.Todo{}).Where("(id = ? OR recurrence_parent_id = ?)", root.ID, root.ID)
+}
+
+// buat occurrence berikutnya setelah occurrence terakhir seri dan setelah now
+// occurrence yang terlewat tidak dibuat, isi todo disalin dari todo pertama seri
+func generateNext(tx *gorm.DB, root *model.Todo, now time.Time) (*model.Todo, error) {
+	rule, err := rrule.Parse(root.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	// occurrence yang sudah dihapus tetap dihitung supaya tidak dibuat ulang
+	var last model.Todo
+	err = inSeries(tx.Unscoped(), root).Order("due_at desc").Take(&last).Error
+	if err != nil {
+		return nil, err
+	}
+
+	after := *last.DueAt
+	if now.After(after) {
+		after = now
+	}
+	next, ok := rule.After(*root.DueAt, after)
+	if !ok {
+		return nil, nil
+	}
+
+	occurrence := model.Todo{
+		UserId:             root.UserId,
+		Title:              root.Title,
+		Description:        root.Description,
+		Priority:           root.Priority,
+		ParentID:           root.ParentID,
+		RecurrenceParentID: &root.ID,
+		DueAt:              &next,
+	}
+	err = tx.Create(&occurrence).Error
+	if err != nil && isDuplicateKey(err) {
+		// sudah dibuat proses lain
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &occurrence, nil
+}
+
+// dipanggil saat occurrence selesai atau dibatalkan, buat occurrence berikutnya jika belum ada
+func nextOccurrence(tx *gorm.DB, todo *model.Todo) error {
+	root, err := seriesRoot(tx, todo)
+	if err != nil || root == nil || todo.DueAt == nil {
+		return err
+	}
+
+	// lock todo pertama seri supaya dua occurrence yang selesai bersamaan tidak membuat occurrence ganda
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model.Todo{}, "id = ?", root.ID).Error
+	if err != nil {
+		return err
+	}
+
+	var open int64
+	err = inSeries(tx, root).Where("due_at > ? AND status NOT IN ?", *todo.DueAt, closedTodoStatuses).Count(&open).Error
+	if err != nil || open > 0 {
+		return err
+	}
+
+	_, err = generateNext(tx, root, time.Now())
+	return err
+}
+
+// pastikan seri punya n occurrence yang belum selesai setelah now, hanya pemilik dan editor yang boleh
+func (s *TodoService) Materialize(ctx context.Context, todoId uint, n int, now time.Time, actorId string) ([]model.Todo, error) {
+	created := []model.Todo{}
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx, todoId, actorId, todoEditors...)
+		if err != nil {
+			return err
+		}
+
+		root, err := seriesRoot(tx, todo)
+		if err != nil {
+			return err
+		}
+		if root == nil {
+			return ErrNotRecurring
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model.Todo{}, "id = ?", root.ID).Error
+		if err != nil {
+			return err
+		}
+
+		var open int64
+		err = inSeries(tx, root).Where("due_at > ? AND status NOT IN ?", now, closedTodoStatuses).Count(&open).Error
+		if err != nil {
+			return err
+		}
+
+		for ; open < int64(n); open++ {
+			occurrence, err := generateNext(tx, root, now)
+			if err != nil {
+				return err
+			}
+			if occurrence == nil {
+				break
+			}
+			created = append(created, *occurrence)
+		}
+		return nil
+	})
+	return created, err
+}
+
+// ubah occurrence todo, scope menentukan apakah hanya occurrence ini atau juga semua occurrence setelahnya
+// EditAllFuture pada occurrence di tengah seri memecah seri: occurrence ini menjadi awal seri baru
+// dan seri lama berhenti sebelum occurrence ini, sehingga occurrence yang sudah lewat tidak ikut berubah
+// hanya pemilik dan editor yang boleh, aturan pengulangan hanya boleh diubah pemilik
+func (s *TodoService) EditOccurrence(ctx context.Context, todoId uint, changes TodoChanges, scope EditScope, actorId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		roles := todoEditors
+		if changes.Recurrence != nil {
+			roles = []string{TodoOwner}
+		}
+		todo, err := authorizeTodo(tx, todoId, actorId, roles...)
+		if err != nil {
+			return err
+		}
+
+		fields := changes.fields()
+		if scope == EditThisOccurrence {
+			if changes.Recurrence != nil {
+				return ErrRecurrenceEditScope
+			}
+			if len(fields) == 0 {
+				return nil
+			}
+			return tx.Model(todo).Updates(fields).Error
+		}
+
+		root, err := seriesRoot(tx, todo)
+		if err != nil {
+			return err
+		}
+		if root == nil {
+			return ErrNotRecurring
+		}
+
+		rule, err := rrule.Parse(root.Recurrence)
+		if err != nil {
+			return err
+		}
+
+		newRule := rule
+		if todo.ID != root.ID {
+			// seri lama berhenti tepat sebelum occurrence ini
+			oldRule := rule
+			if rule.Count > 0 {
+				oldRule.Count = rule.CountBefore(*root.DueAt, *todo.DueAt)
+				newRule.Count = rule.Count - oldRule.Count
+			} else {
+				oldRule.Until = todo.DueAt.Add(-time.Second)
+			}
+
+			err = tx.Model(&model.Todo{}).Where("id = ?", root.ID).Update("recurrence", oldRule.String()).Error
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&model.Todo{}).Where("recurrence_parent_id = ? AND due_at > ?", root.ID, *todo.DueAt).
+				Update("recurrence_parent_id", todo.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if changes.Recurrence != nil {
+			newRule, err = rrule.Parse(*changes.Recurrence)
+			if err != nil {
+				return err
+			}
+
+			// occurrence yang sudah dibuat dengan aturan lama dan belum dikerjakan di soft delete
+			// dan dilepas dari seri supaya tidak bentrok dengan occurrence dari aturan baru
+			err = tx.Model(&model.Todo{}).Where("recurrence_parent_id = ? AND due_at > ? AND status = ?", todo.ID, *todo.DueAt, TodoOpen).
+				UpdateColumns(map[string]interface{}{"deleted_at": time.Now(), "recurrence_parent_id": nil}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		fields["recurrence"] = newRule.String()
+		fields["recurrence_parent_id"] = nil
+		err = tx.Model(todo).Updates(fields).Error
+		if err != nil {
+			return err
+		}
+
+		delete(fields, "recurrence")
+		delete(fields, "recurrence_parent_id")
+		if len(fields) == 0 {
+			return nil
+		}
+		return tx.Model(&model.Todo{}).Where("recurrence_parent_id = ? AND status NOT IN ?", todo.ID, closedTodoStatuses).Updates(fields).Error
+	})
+}
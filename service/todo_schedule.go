@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+)
+
+const (
+	PriorityNone   = 0
+	PriorityLow    = 1
+	PriorityMedium = 2
+	PriorityHigh   = 3
+)
+
+// status todo yang sudah selesai, tidak dihitung overdue dan tidak diingatkan
+var closedTodoStatuses = []string{TodoDone, TodoCancelled}
+
+// todo yang lewat tenggat dan belum selesai
+func Overdue(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("due_at < ? AND status NOT IN ?", now, closedTodoStatuses)
+	}
+}
+
+// todo yang belum selesai dengan tenggat dalam rentang d dari now
+func DueWithin(now time.Time, d time.Duration) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("due_at >= ? AND due_at < ? AND status NOT IN ?", now, now.Add(d), closedTodoStatuses)
+	}
+}
+
+// urutkan dari prioritas tertinggi, todo tanpa tenggat di paling bawah
+func ByPriority(db *gorm.DB) *gorm.DB {
+	return db.Order("priority desc").Order("due_at IS NULL, due_at asc")
+}
+
+// todo dengan tenggat di hari yang sama dengan now menurut zona waktu tz, pakai User.Location untuk zona waktu user
+func Today(now time.Time, tz *time.Location) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		start, end := dayBounds(now, tz)
+		return db.Where("due_at >= ? AND due_at < ?", start, end)
+	}
+}
+
+// awal dan akhir hari dari waktu now di zona waktu tz
+func dayBounds(now time.Time, tz *time.Location) (time.Time, time.Time) {
+	local := now.In(tz)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, tz)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// todo yang perlu diingatkan karna tenggatnya kurang dari lead dari now
+// setiap todo hanya dikembalikan sekali per due_at, walaupun dijalankan berulang atau bersamaan
+// jika due_at diubah todo akan diingatkan lagi
+func (s *TodoService) DueReminders(ctx context.Context, now time.Time, lead time.Duration) ([]model.Todo, error) {
+	var candidates []model.Todo
+	err := s.DB.WithContext(ctx).
+		Where("due_at IS NOT NULL AND due_at <= ? AND status NOT IN ?", now.Add(lead), closedTodoStatuses).
+		Where("NOT EXISTS (SELECT 1 FROM todo_reminders WHERE todo_reminders.todo_id = todos.id AND todo_reminders.due_at = todos.due_at)").
+		Order("due_at asc, id asc").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	todos := []model.Todo{}
+	for _, todo := range candidates {
+		// unique index (todo_id, due_at) memastikan hanya satu proses yang berhasil mencatat reminder
+		err = s.DB.WithContext(ctx).Create(&model.TodoReminder{TodoId: todo.ID, DueAt: *todo.DueAt}).Error
+		if err != nil && isDuplicateKey(err) {
+			continue
+		}
+		if err != nil {
+			return todos, err
+		}
+		todos = append(todos, todo)
+	}
+
+	return todos, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CollaboratorViewer = "viewer"
+	CollaboratorEditor = "editor"
+
+	// role pemilik todo, tidak disimpan di todo_collaborators
+	TodoOwner = "owner"
+)
+
+var (
+	ErrTodoForbidden  = errors.New("user tidak punya akses untuk mengubah todo ini")
+	ErrInvalidRole    = errors.New("role collaborator harus viewer atau editor")
+	ErrShareWithOwner = errors.New("todo tidak bisa dibagikan ke pemiliknya sendiri")
+	ErrTodoNotVisible = errors.New("todo tidak ditemukan atau tidak dibagikan ke user")
+)
+
+// todo milik user ditambah todo yang dibagikan ke user
+func VisibleTo(userId string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(todos.user_id = ? OR EXISTS (SELECT 1 FROM todo_collaborators WHERE todo_collaborators.todo_id = todos.id AND todo_collaborators.user_id = ?))", userId, userId)
+	}
+}
+
+// role user terhadap todo: owner, editor atau viewer
+// baris todo di lock sampai transaction selesai supaya Unshare yang berjalan bersamaan menunggu
+func todoRole(tx *gorm.DB, todoId uint, userId string) (*model.Todo, string, error) {
+	var todo model.Todo
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&todo, "id = ?", todoId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrTodoNotVisible
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if todo.UserId == userId {
+		return &todo, TodoOwner, nil
+	}
+
+	var roles []string
+	err = tx.Model(&model.TodoCollaborator{}).Where("todo_id = ? AND user_id = ?", todoId, userId).Pluck("role", &roles).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if len(roles) == 0 {
+		return nil, "", ErrTodoNotVisible
+	}
+	return &todo, roles[0], nil
+}
+
+// role yang boleh mengubah isi todo
+var todoEditors = []string{TodoOwner, CollaboratorEditor}
+
+// pastikan actor punya salah satu roles, harus dipanggil di dalam transaction yang melakukan perubahan
+// supaya akses yang dicabut di tengah jalan tidak ikut terpakai
+func authorizeTodo(tx *gorm.DB, todoId uint, actorId string, roles ...string) (*model.Todo, error) {
+	todo, role, err := todoRole(tx, todoId, actorId)
+	if err != nil {
+		return nil, err
+	}
+	for _, allowed := range roles {
+		if role == allowed {
+			return todo, nil
+		}
+	}
+	return nil, ErrTodoForbidden
+}
+
+// bagikan todo ke user lain, hanya pemilik yang boleh membagikan
+// jika user sudah menjadi collaborator rolenya diganti
+func (s *TodoService) Share(ctx context.Context, todoId uint, userId string, role string, actorId string) error {
+	if role != CollaboratorViewer && role != CollaboratorEditor {
+		return ErrInvalidRole
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx, todoId, actorId, TodoOwner)
+		if err != nil {
+			return err
+		}
+		if todo.UserId == userId {
+			return ErrShareWithOwner
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "todo_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+		}).Create(&model.TodoCollaborator{TodoId: todoId, UserId: userId, Role: role}).Error
+	})
+}
+
+// cabut akses user, pemilik bisa mencabut siapa saja dan collaborator bisa keluar sendiri
+func (s *TodoService) Unshare(ctx context.Context, todoId uint, userId string, actorId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, actorRole, err := todoRole(tx, todoId, actorId)
+		if err != nil {
+			return err
+		}
+		if actorRole != TodoOwner && actorId != userId {
+			return ErrTodoForbidden
+		}
+
+		return tx.Where("todo_id = ? AND user_id = ?", todoId, userId).Delete(&model.TodoCollaborator{}).Error
+	})
+}
+
+// todo yang bisa dilihat user beserta collaborator dan usernya
+// preload dijalankan per level (todos, todo_collaborators, users) jadi tidak ada query N+1
+func (s *TodoService) ListVisible(ctx context.Context, userId string) ([]model.Todo, error) {
+	var todos []model.Todo
+	err := s.DB.WithContext(ctx).Scopes(VisibleTo(userId), ByRank).Preload("Collaborators.User").Find(&todos).Error
+	return todos, err
+}
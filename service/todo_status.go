@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+)
+
+const (
+	TodoOpen       = "open"
+	TodoInProgress = "in_progress"
+	TodoBlocked    = "blocked"
+	TodoDone       = "done"
+	TodoCancelled  = "cancelled"
+)
+
+var ErrInvalidTransition = errors.New("perubahan status todo tidak diizinkan")
+
+// perubahan status yang diizinkan, key adalah status asal
+var TodoTransitions = map[string][]string{
+	TodoOpen:       {TodoInProgress, TodoBlocked, TodoDone, TodoCancelled},
+	TodoInProgress: {TodoOpen, TodoBlocked, TodoDone, TodoCancelled},
+	TodoBlocked:    {TodoOpen, TodoInProgress, TodoCancelled},
+	TodoDone:       {TodoOpen},
+	TodoCancelled:  {TodoOpen},
+}
+
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s: %s ke %s", ErrInvalidTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+func canTransition(from string, to string) bool {
+	for _, status := range TodoTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ubah status todo dan catat riwayatnya, completed_at diisi saat status menjadi done
+// hanya pemilik dan editor yang boleh
+func (s *TodoService) Transition(ctx context.Context, todoId uint, status string, actorId string) (*model.Todo, error) {
+	var todo model.Todo
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		locked, err := authorizeTodo(tx, todoId, actorId, todoEditors...)
+		if err != nil {
+			return err
+		}
+		todo = *locked
+
+		from := todo.Status
+		if !canTransition(from, status) {
+			return &TransitionError{From: from, To: status}
+		}
+
+		var completedAt *time.Time
+		if status == TodoDone {
+			now := time.Now()
+			completedAt = &now
+		}
+
+		err = tx.Model(&todo).Updates(map[string]interface{}{"status": status, "completed_at": completedAt}).Error
+		if err != nil {
+			return err
+		}
+		todo.Status = status
+		todo.CompletedAt = completedAt
+
+		err = tx.Create(&model.TodoStatusChange{
+			TodoId:     todo.ID,
+			FromStatus: from,
+			ToStatus:   status,
+			ActorId:    actorId,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// todo berulang yang selesai atau dibatalkan dilanjutkan ke occurrence berikutnya
+		if status == TodoDone || status == TodoCancelled {
+			return nextOccurrence(tx, &todo)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &todo, nil
+}
+
+// riwayat status todo dari yang paling lama
+func (s *TodoService) StatusHistory(ctx context.Context, todoId uint) ([]model.TodoStatusChange, error) {
+	var changes []model.TodoStatusChange
+	err := s.DB.WithContext(ctx).Where("todo_id = ?", todoId).Order("created_at asc, id asc").Find(&changes).Error
+	return changes, err
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTodoCycle         = errors.New("todo tidak bisa dipindah ke dalam subtasknya sendiri")
+	ErrTodoOwnerMismatch = errors.New("todo milik user yang berbeda")
+)
+
+// id todo beserta semua turunannya, UNION (bukan UNION ALL) supaya berhenti jika data lama punya cycle
+// bisa dipakai di MySQL 8 dan SQLite
+const subtreeQuery = `WITH RECURSIVE subtree AS (
+	SELECT id FROM todos WHERE id = ? AND deleted_at IS NULL
+	UNION
+	SELECT todos.id FROM todos JOIN subtree ON todos.parent_id = subtree.id WHERE todos.deleted_at IS NULL
+)
+SELECT todos.* FROM todos JOIN subtree ON subtree.id = todos.id ORDER BY todos.id`
+
+// soft delete todo beserta semua turunannya dengan deleted_at yang sama supaya bisa di restore bersama
+// turunan yang sudah dihapus lebih dulu tetap memakai deleted_at lamanya
+const deleteSubtreeQuery = `UPDATE todos SET deleted_at = ? WHERE deleted_at IS NULL AND id IN (
+	SELECT id FROM (
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM todos WHERE id = ?
+			UNION
+			SELECT todos.id FROM todos JOIN subtree ON todos.parent_id = subtree.id
+		)
+		SELECT id FROM subtree
+	) AS descendants
+)`
+
+type TodoTree struct {
+	Todo     model.Todo
+	Subtasks []*TodoTree
+	// jumlah turunan yang tidak dibatalkan dan yang sudah selesai
+	Descendants int
+	Completed   int
+}
+
+// persentase turunan yang sudah selesai, todo tanpa turunan dihitung dari statusnya sendiri
+func (t *TodoTree) Progress() float64 {
+	if t.Descendants == 0 {
+		if t.Todo.Status == TodoDone {
+			return 1
+		}
+		return 0
+	}
+	return float64(t.Completed) / float64(t.Descendants)
+}
+
+func (t *TodoTree) count() {
+	t.Descendants = 0
+	t.Completed = 0
+	for _, subtask := range t.Subtasks {
+		subtask.count()
+		t.Descendants += subtask.Descendants
+		t.Completed += subtask.Completed
+		if subtask.Todo.Status == TodoCancelled {
+			continue
+		}
+		t.Descendants++
+		if subtask.Todo.Status == TodoDone {
+			t.Completed++
+		}
+	}
+}
+
+func subtree(tx *gorm.DB, rootId uint) ([]model.Todo, error) {
+	var todos []model.Todo
+	err := tx.Raw(subtreeQuery, rootId).Scan(&todos).Error
+	return todos, err
+}
+
+// ambil todo beserta semua subtasknya dengan satu query recursive
+func (s *TodoService) Tree(ctx context.Context, rootId uint) (*TodoTree, error) {
+	todos, err := subtree(s.DB.WithContext(ctx), rootId)
+	if err != nil {
+		return nil, err
+	}
+	if len(todos) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	nodes := map[uint]*TodoTree{}
+	for _, todo := range todos {
+		nodes[todo.ID] = &TodoTree{Todo: todo, Subtasks: []*TodoTree{}}
+	}
+
+	// todos sudah urut berdasarkan id, jadi urutan subtask stabil
+	for _, todo := range todos {
+		if todo.ID == rootId || todo.ParentID == nil {
+			continue
+		}
+		parent, ok := nodes[*todo.ParentID]
+		if ok {
+			parent.Subtasks = append(parent.Subtasks, nodes[todo.ID])
+		}
+	}
+
+	root := nodes[rootId]
+	root.count()
+	return root, nil
+}
+
+// pindahkan todo beserta subtasknya ke parent lain, parentId nil berarti jadi todo paling atas
+// actor harus pemilik atau editor dari todo dan parent barunya
+func (s *TodoService) MoveSubtree(ctx context.Context, todoId uint, parentId *uint, actorId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx, todoId, actorId, todoEditors...)
+		if err != nil {
+			return err
+		}
+
+		if parentId != nil {
+			parent, err := authorizeTodo(tx, *parentId, actorId, todoEditors...)
+			if err != nil {
+				return err
+			}
+			if parent.UserId != todo.UserId {
+				return ErrTodoOwnerMismatch
+			}
+
+			err = lockAncestors(tx, todo.ID, parent.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(todo).Update("parent_id", parentId).Error
+	})
+}
+
+// telusuri parent mulai dari parentId, todo tidak boleh ada di rantai parent barunya sendiri
+// setiap ancestor di lock supaya dua MoveSubtree yang berjalan bersamaan tidak bisa membuat cycle
+// ancestor yang sudah di soft delete tetap ditelusuri karna bisa di restore
+func lockAncestors(tx *gorm.DB, todoId uint, parentId uint) error {
+	visited := map[uint]bool{}
+	for id := &parentId; id != nil; {
+		// data lama yang sudah punya cycle juga ditolak
+		if *id == todoId || visited[*id] {
+			return ErrTodoCycle
+		}
+		visited[*id] = true
+
+		var ancestor model.Todo
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "parent_id").Take(&ancestor, "id = ?", *id).Error
+		if err != nil {
+			return err
+		}
+		id = ancestor.ParentID
+	}
+	return nil
+}
+
+// soft delete todo beserta semua subtasknya, hanya pemilik yang boleh menghapus
+func (s *TodoService) DeleteSubtree(ctx context.Context, todoId uint, actorId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		todo, err := authorizeTodo(tx, todoId, actorId, TodoOwner)
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(deleteSubtreeQuery, time.Now(), todo.ID).Error
+	})
+}
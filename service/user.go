@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+)
+
+type UserService struct {
+	DB *gorm.DB
+	// policy erase per table, jika kosong pakai DefaultErasePolicies
+	ErasePolicies map[string]ErasePolicy
+}
+
+func NewUserService(db *gorm.DB) *UserService {
+	return &UserService{DB: db}
+}
+
+// soft delete user beserta wallet dan addressnya dalam satu transaction
+// semua baris diberi deleted_at yang sama supaya bisa direstore bareng
+func (s *UserService) DeactivateUser(ctx context.Context, id string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		err := tx.Take(&user, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		// pakai UpdateColumn supaya updated_at tidak ikut berubah
+		err = tx.Model(&model.Wallet{}).Where("user_id = ?", id).UpdateColumn("deleted_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&model.Address{}).Where("user_id = ?", id).UpdateColumn("deleted_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&user).UpdateColumn("deleted_at", now).Error
+	})
+}
+
+// kebalikan DeactivateUser, hanya restore baris yang ikut terhapus saat user dinonaktifkan
+func (s *UserService) ReactivateUser(ctx context.Context, id string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		err := tx.Unscoped().Where("deleted_at IS NOT NULL").Take(&user, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		deletedAt := user.DeletedAt.Time
+		err = tx.Unscoped().Model(&model.Wallet{}).Where("user_id = ? AND deleted_at = ?", id, deletedAt).UpdateColumn("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Model(&model.Address{}).Where("user_id = ? AND deleted_at = ?", id, deletedAt).UpdateColumn("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Model(&user).UpdateColumn("deleted_at", nil).Error
+	})
+}
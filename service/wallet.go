@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidAmount       = errors.New("amount harus lebih dari 0")
+	ErrInsufficientBalance = errors.New("balance tidak cukup")
+	ErrSameWallet          = errors.New("wallet asal dan tujuan sama")
+)
+
+type WalletService struct {
+	DB *gorm.DB
+}
+
+func NewWalletService(db *gorm.DB) *WalletService {
+	return &WalletService{DB: db}
+}
+
+// ambil wallet sekaligus lock barisnya sampai transaction selesai
+func lockWallet(tx *gorm.DB, walletId string) (*model.Wallet, error) {
+	var wallet model.Wallet
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&wallet, "id = ?", walletId).Error
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// catat entry ledger dan update balance wallet, wallet harus sudah di lock
+func postEntry(tx *gorm.DB, wallet *model.Wallet, amount int64, referenceType string, referenceId string) (*model.WalletEntry, error) {
+	err := ensureWalletActive(wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	before := wallet.Balance
+	balance, err := before.Add(money.New(amount, wallet.Currency))
+	if err != nil {
+		return nil, err
+	}
+	if balance.IsNegative() {
+		return nil, ErrInsufficientBalance
+	}
+
+	// debit tidak boleh memakai dana yang sedang ditahan
+	if amount < 0 {
+		held, err := activeHolds(tx, wallet.Id, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if balance.Amount < held {
+			return nil, ErrInsufficientBalance
+		}
+	}
+
+	entry := model.WalletEntry{
+		WalletId:      wallet.Id,
+		Amount:        money.New(amount, wallet.Currency),
+		BalanceAfter:  balance,
+		ReferenceType: referenceType,
+		ReferenceId:   referenceId,
+	}
+	err = tx.Create(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// pakai UpdateColumn karna kolom updated_at wallet salah mapping ke created_at
+	err = tx.Model(wallet).UpdateColumn("balance", balance).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordTierChange(tx, wallet, before.Amount, balance.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (s *WalletService) Credit(ctx context.Context, walletId string, amount int64, referenceType string, referenceId string) (*model.WalletEntry, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	return s.post(ctx, walletId, amount, referenceType, referenceId)
+}
+
+func (s *WalletService) Debit(ctx context.Context, walletId string, amount int64, referenceType string, referenceId string) (*model.WalletEntry, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	return s.post(ctx, walletId, -amount, referenceType, referenceId)
+}
+
+func (s *WalletService) post(ctx context.Context, walletId string, amount int64, referenceType string, referenceId string) (*model.WalletEntry, error) {
+	var entry *model.WalletEntry
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = postWallet(tx, walletId, amount, referenceType, referenceId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func postWallet(tx *gorm.DB, walletId string, amount int64, referenceType string, referenceId string) (*model.WalletEntry, error) {
+	wallet, err := lockWallet(tx, walletId)
+	if err != nil {
+		return nil, err
+	}
+
+	return postEntry(tx, wallet, amount, referenceType, referenceId)
+}
+
+type walletRequest struct {
+	Operation     string
+	WalletId      string
+	Amount        int64
+	ReferenceType string
+	ReferenceId   string
+}
+
+// sama seperti Credit, tapi request yang diulang dengan key yang sama tidak menambah saldo lagi
+func (s *WalletService) CreditIdempotent(ctx context.Context, key string, walletId string, amount int64, referenceType string, referenceId string) (*model.WalletEntry, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	request := walletRequest{"credit", walletId, amount, referenceType, referenceId}
+	return RunIdempotent(ctx, s.DB, key, request, func(tx *gorm.DB) (*model.WalletEntry, error) {
+		return postWallet(tx, walletId, amount, referenceType, referenceId)
+	})
+}
+
+func (s *WalletService) DebitIdempotent(ctx context.Context, key string, walletId string, amount int64, referenceType string, referenceId string) (*model.WalletEntry, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	request := walletRequest{"debit", walletId, amount, referenceType, referenceId}
+	return RunIdempotent(ctx, s.DB, key, request, func(tx *gorm.DB) (*model.WalletEntry, error) {
+		return postWallet(tx, walletId, -amount, referenceType, referenceId)
+	})
+}
+
+func (s *WalletService) CreateWallet(ctx context.Context, key string, wallet model.Wallet) (*model.Wallet, error) {
+	return RunIdempotent(ctx, s.DB, key, wallet, func(tx *gorm.DB) (*model.Wallet, error) {
+		err := tx.Create(&wallet).Error
+		return &wallet, err
+	})
+}
+
+// hitung ulang balance wallet dari total semua entry ledgernya
+func (s *WalletService) RebuildBalance(ctx context.Context, walletId string) (int64, error) {
+	var balance int64
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		wallet, err := lockWallet(tx, walletId)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&model.WalletEntry{}).Select("coalesce(sum(amount), 0)").Where("wallet_id = ?", walletId).Scan(&balance).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(wallet).UpdateColumn("balance", balance).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+// jumlah percobaan ulang transfer jika terjadi deadlock
+const transferMaxRetries = 5
+
+type TransferResult struct {
+	ReferenceId string
+	Debit       *model.WalletEntry
+	Credit      *model.WalletEntry
+}
+
+// pindahkan saldo antar wallet, kedua sisi ledger ditulis dalam satu transaction
+func (s *WalletService) Transfer(ctx context.Context, fromWalletId string, toWalletId string, amount int64) (*TransferResult, error) {
+	result := &TransferResult{ReferenceId: newReferenceId("transfer")}
+	err := retryTransaction(ctx, s.DB, func(tx *gorm.DB) error {
+		return transfer(tx, fromWalletId, toWalletId, amount, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// jalankan fn dalam transaction, diulang jika deadlock atau lock wait timeout
+// fn harus aman dijalankan ulang karna transaction sebelumnya sudah di rollback
+func retryTransaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	var err error
+	for attempt := 0; attempt < transferMaxRetries; attempt++ {
+		err = db.WithContext(ctx).Transaction(fn)
+		if err == nil || !isRetryable(err) {
+			break
+		}
+		time.Sleep(time.Duration(attempt+1) * 10 * time.Millisecond)
+	}
+	return err
+}
+
+// tulis kedua sisi ledger transfer di dalam transaction yang sudah berjalan
+// dipakai Transfer dan transfer terjadwal, jadi validasinya ada di sini
+func transfer(tx *gorm.DB, fromWalletId string, toWalletId string, amount int64, result *TransferResult) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if fromWalletId == toWalletId {
+		return ErrSameWallet
+	}
+
+	wallets, err := lockWallets(tx, fromWalletId, toWalletId)
+	if err != nil {
+		return err
+	}
+
+	if wallets[fromWalletId].Currency != wallets[toWalletId].Currency {
+		return money.ErrCurrencyMismatch
+	}
+
+	result.Debit, err = postEntry(tx, wallets[fromWalletId], -amount, "transfer", result.ReferenceId)
+	if err != nil {
+		return err
+	}
+
+	result.Credit, err = postEntry(tx, wallets[toWalletId], amount, "transfer", result.ReferenceId)
+	return err
+}
+
+// lock beberapa wallet sekaligus, selalu urut berdasarkan id
+// supaya dua transfer yang arahnya berlawanan tidak saling deadlock
+func lockWallets(tx *gorm.DB, walletIds ...string) (map[string]*model.Wallet, error) {
+	ids := append([]string{}, walletIds...)
+	sort.Strings(ids)
+
+	wallets := map[string]*model.Wallet{}
+	for _, id := range ids {
+		wallet, err := lockWallet(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		wallets[id] = wallet
+	}
+
+	return wallets, nil
+}
+
+// deadlock dan lock wait timeout aman untuk diulang
+func isRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+	return strings.Contains(err.Error(), "database is locked")
+}
+
+func newReferenceId(prefix string) string {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return prefix + "-" + hex.EncodeToString(random)
+}
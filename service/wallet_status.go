@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"gorm.io/gorm"
+)
+
+const (
+	WalletActive = "active"
+	WalletFrozen = "frozen"
+	WalletClosed = "closed"
+)
+
+var (
+	ErrWalletFrozen        = errors.New("wallet sedang dibekukan")
+	ErrWalletClosed        = errors.New("wallet sudah ditutup")
+	ErrWalletNotEmpty      = errors.New("wallet yang masih punya saldo atau hold aktif tidak bisa ditutup")
+	ErrInvalidWalletStatus = errors.New("perubahan status wallet tidak valid")
+	ErrReasonRequired      = errors.New("alasan perubahan status wallet wajib diisi")
+)
+
+// wallet yang frozen atau closed tidak boleh dipakai untuk pergerakan dana
+func ensureWalletActive(wallet *model.Wallet) error {
+	switch wallet.Status {
+	case WalletFrozen:
+		return fmt.Errorf("%w: %s", ErrWalletFrozen, wallet.Id)
+	case WalletClosed:
+		return fmt.Errorf("%w: %s", ErrWalletClosed, wallet.Id)
+	}
+	return nil
+}
+
+// bekukan wallet, saldo tetap ada tapi semua debit, credit, transfer dan hold ditolak
+func (s *WalletService) FreezeWallet(ctx context.Context, walletId string, actor string, reason string) error {
+	return s.changeWalletStatus(ctx, walletId, WalletFrozen, actor, reason)
+}
+
+func (s *WalletService) UnfreezeWallet(ctx context.Context, walletId string, actor string, reason string) error {
+	return s.changeWalletStatus(ctx, walletId, WalletActive, actor, reason)
+}
+
+// tutup wallet secara permanen, saldo harus sudah kosong
+func (s *WalletService) CloseWallet(ctx context.Context, walletId string, actor string, reason string) error {
+	return s.changeWalletStatus(ctx, walletId, WalletClosed, actor, reason)
+}
+
+func (s *WalletService) changeWalletStatus(ctx context.Context, walletId string, status string, actor string, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return ErrReasonRequired
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		wallet, err := lockWallet(tx, walletId)
+		if err != nil {
+			return err
+		}
+
+		from := wallet.Status
+		valid := (from == WalletActive && status == WalletFrozen) ||
+			(from == WalletFrozen && status == WalletActive) ||
+			(from != WalletClosed && status == WalletClosed)
+		if !valid {
+			return fmt.Errorf("%w: %s ke %s", ErrInvalidWalletStatus, from, status)
+		}
+
+		if status == WalletClosed {
+			held, err := activeHolds(tx, walletId, time.Now())
+			if err != nil {
+				return err
+			}
+			if !wallet.Balance.IsZero() || held != 0 {
+				return ErrWalletNotEmpty
+			}
+		}
+
+		err = tx.Model(wallet).UpdateColumn("status", status).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&model.WalletStatusChange{
+			WalletId:   walletId,
+			FromStatus: from,
+			ToStatus:   status,
+			Reason:     reason,
+			Actor:      actor,
+		}).Error
+	})
+}
+
+// riwayat status wallet dari yang paling lama
+func (s *WalletService) WalletStatusHistory(ctx context.Context, walletId string) ([]model.WalletStatusChange, error) {
+	var changes []model.WalletStatusChange
+	err := s.DB.WithContext(ctx).Where("wallet_id = ?", walletId).Order("created_at asc, id asc").Find(&changes).Error
+	return changes, err
+}
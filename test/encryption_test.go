@@ -0,0 +1,96 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/encryption"
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// key ring yang dipakai semua test, diset di OpenConnection
+func testKeyRing() *encryption.KeyRing {
+	return &encryption.KeyRing{
+		Primary:  "k1",
+		Keys:     map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")},
+		IndexKey: []byte("index-key"),
+	}
+}
+
+func TestEncryptedSerializer(t *testing.T) {
+	ring := testKeyRing()
+	encryption.SetKeyRing(ring)
+	defer encryption.SetKeyRing(testKeyRing())
+
+	user := model.User{
+		Id:       "800",
+		Password: "rahasia",
+		Name: model.Name{
+			FirstName: "Encrypted",
+		},
+		Addresses: []model.Address{
+			{UserId: "800", Address: "Jalan Rahasia"},
+		},
+	}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	// di database tersimpan ciphertext
+	var raw string
+	err = db.Raw("SELECT address FROM addresses WHERE user_id = ?", "800").Scan(&raw).Error
+	assert.Nil(t, err)
+	assert.True(t, encryption.IsEncrypted(raw))
+	assert.Equal(t, "k1", encryption.KeyId(raw))
+
+	// pencarian equality lewat blind index
+	var address model.Address
+	err = db.Take(&address, "address_bidx = ?", encryption.BlindIndex("jalan rahasia")).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "Jalan Rahasia", address.Address)
+
+	// update lewat map tidak melewati serializer dan blind index, jadi ditolak
+	err = db.Model(&address).Update("address", "Jalan Bocor").Error
+	assert.ErrorIs(t, err, encryption.ErrMapUpdate)
+	err = db.Model(&model.User{}).Where("id = ?", "800").Updates(map[string]interface{}{"first_name": "Bocor"}).Error
+	assert.ErrorIs(t, err, encryption.ErrMapUpdate)
+
+	// update lewat struct tetap terenkripsi dan blind indexnya ikut berubah
+	address.Address = "Jalan Baru"
+	err = db.Save(&address).Error
+	assert.Nil(t, err)
+
+	var updated model.Address
+	err = db.Take(&updated, "address_bidx = ?", encryption.BlindIndex("jalan baru")).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "Jalan Baru", updated.Address)
+
+	// tanpa key ring kolom terenkripsi tidak bisa ditulis
+	encryption.SetKeyRing(nil)
+	err = db.Create(&model.Address{UserId: "800", Address: "Jalan Plaintext"}).Error
+	assert.ErrorIs(t, err, encryption.ErrNoKeyRing)
+	encryption.SetKeyRing(ring)
+
+	// rotasi key, data lama tetap bisa dibaca lalu dienkripsi ulang dengan key baru
+	ring.Keys["k2"] = []byte("fedcba9876543210fedcba9876543210")
+	ring.Primary = "k2"
+	rotated, err := encryption.ReEncrypt(context.Background(), db, "addresses", "id", []string{"address"}, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rotated)
+
+	err = db.Raw("SELECT address FROM addresses WHERE user_id = ?", "800").Scan(&raw).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "k2", encryption.KeyId(raw))
+
+	var found model.User
+	err = db.Preload("Addresses").Take(&found, "first_name_bidx = ?", encryption.BlindIndex("Encrypted")).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "Encrypted", found.Name.FirstName)
+	assert.Equal(t, "Jalan Baru", found.Addresses[0].Address)
+
+	// bersihkan lagi supaya test lain yang jalan tanpa key ring tidak gagal decrypt
+	err = db.Unscoped().Where("user_id = ?", "800").Delete(&model.Address{}).Error
+	assert.Nil(t, err)
+	err = db.Unscoped().Delete(&model.User{}, "id = ?", "800").Error
+	assert.Nil(t, err)
+}
@@ -7,7 +7,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dickidarmawansaputra/belajar-gorm/encryption"
 	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"github.com/dickidarmawansaputra/belajar-gorm/optimisticlock"
+	"github.com/dickidarmawansaputra/belajar-gorm/service"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -31,6 +35,19 @@ func OpenConnection() *gorm.DB {
 		panic(err)
 	}
 
+	// plugin untuk kolom optimisticlock.Version
+	err = db.Use(optimisticlock.Plugin{})
+	if err != nil {
+		panic(err)
+	}
+
+	// kolom terenkripsi hanya bisa ditulis lewat struct dan butuh key ring
+	err = db.Use(encryption.Plugin{})
+	if err != nil {
+		panic(err)
+	}
+	encryption.SetKeyRing(testKeyRing())
+
 	sqlDB, err := db.DB()
 	if err != nil {
 		panic(err)
@@ -221,28 +238,30 @@ func TestQueryAllObject(t *testing.T) {
 	assert.Equal(t, 4, len(users))
 }
 
+// first_name terenkripsi dengan nonce acak, jadi tidak bisa dicari dengan = atau LIKE
+// pencarian nama hanya bisa exact match lewat blind index first_name_bidx, pencarian substring tidak bisa lagi
 func TestQueryCondition(t *testing.T) {
 	var users []model.User
-	err := db.Where("first_name like ?", "%User%").
+	err := db.Where("first_name_bidx = ?", encryption.BlindIndex("User 5")).
 		Where("password = ?", "rahasia").Find(&users).Error
 	assert.Nil(t, err)
-	assert.Equal(t, 13, len(users))
+	assert.Equal(t, 1, len(users))
 }
 
 func TestQueryOrOperator(t *testing.T) {
 	var users []model.User
-	err := db.Where("first_name like ?", "%User%").
-		Or("password = ?", "rahasia").Find(&users).Error
+	err := db.Where("first_name_bidx = ?", encryption.BlindIndex("User 5")).
+		Or("first_name_bidx = ?", encryption.BlindIndex("User 6")).Find(&users).Error
 	assert.Nil(t, err)
-	assert.Equal(t, 14, len(users))
+	assert.Equal(t, 2, len(users))
 }
 
 func TestQueryNotOperator(t *testing.T) {
 	var users []model.User
-	err := db.Not("first_name like ?", "%User%").
-		Where("password = ?", "rahasia").Find(&users).Error
+	err := db.Not("first_name_bidx = ?", encryption.BlindIndex("User 5")).
+		Where("id in ?", []string{"4", "5", "6"}).Find(&users).Error
 	assert.Nil(t, err)
-	assert.Equal(t, 1, len(users))
+	assert.Equal(t, 2, len(users))
 }
 
 func TestQuerySelectFields(t *testing.T) {
@@ -258,11 +277,9 @@ func TestQuerySelectFields(t *testing.T) {
 
 func TestQueryStructCondition(t *testing.T) {
 	userCondition := model.User{
-		Name: model.Name{
-			FirstName: "User 5",
-			LastName:  "", // tidak bisa, karna dianggap default value. gunakan map condition
-		},
-		Password: "rahasia",
+		// FirstName terenkripsi, jadi kondisi nama pakai blind index
+		FirstNameIndex: encryption.BlindIndex("User 5"),
+		Password:       "rahasia",
 	}
 
 	var users []model.User
@@ -315,10 +332,17 @@ func TestUpdate(t *testing.T) {
 }
 
 func TestUpdateSelectedColumns(t *testing.T) {
+	// kolom nama terenkripsi, update lewat map ditolak karna tidak melewati serializer
 	err := db.Model(&model.User{}).Where("id = ?", "1").Updates(map[string]interface{}{
 		"middle_name": "",
 		"last_name":   "Update",
 	}).Error
+	assert.ErrorIs(t, err, encryption.ErrMapUpdate)
+
+	err = db.Model(&model.User{}).Where("id = ?", "1").Updates(map[string]interface{}{
+		"password":  "rahasiaupdate",
+		"time_zone": "Asia/Jakarta",
+	}).Error
 	assert.Nil(t, err)
 
 	err = db.Model(&model.User{}).Where("id = ?", "1").Update("password", "rahasiailahi").Error
@@ -471,7 +495,7 @@ func TestWallet(t *testing.T) {
 	wallet := model.Wallet{
 		Id:      "1",
 		UserId:  "1",
-		Balance: 1000,
+		Balance: money.New(1000, "IDR"),
 	}
 
 	err := db.Create(&wallet).Error
@@ -479,21 +503,23 @@ func TestWallet(t *testing.T) {
 }
 
 // one to one relationship
+// user punya satu wallet per mata uang, jadi has one didapat dari has many dengan kondisi currency
 func TestHasOne(t *testing.T) {
 	var user model.User
-	err := db.Model(&model.User{}).Preload("Wallet").Take(&user, "id = ?", "1").Error
+	err := db.Model(&model.User{}).Preload("Wallets", "currency = ?", money.DefaultCurrency).Take(&user, "id = ?", "1").Error
 	assert.Nil(t, err)
 	assert.Equal(t, "1", user.Id)
-	assert.Equal(t, "1", user.Wallet.Id)
+	assert.Equal(t, 1, len(user.Wallets))
+	assert.Equal(t, "1", user.Wallets[0].Id)
 }
 
 // Jika one to one sebaiknya gunakan join saja karna cukup sekali query
 func TestHasOneJoin(t *testing.T) {
-	var user model.User
-	err := db.Model(&model.User{}).Joins("Wallet").Take(&user, "users.id = ?", "1").Error
+	var wallet model.Wallet
+	err := db.Model(&model.Wallet{}).Joins("User").Take(&wallet, "wallets.id = ?", "1").Error
 	assert.Nil(t, err)
-	assert.Equal(t, "1", user.Id)
-	assert.Equal(t, "1", user.Wallet.Id)
+	assert.Equal(t, "1", wallet.Id)
+	assert.Equal(t, "1", wallet.User.Id)
 }
 
 // GORM akan auto create update jika ada relasi
@@ -504,10 +530,12 @@ func TestAutoCreateUpdate(t *testing.T) {
 			FirstName: "User 200",
 		},
 		Password: "rahasia",
-		Wallet: model.Wallet{
-			Id:      "2",
-			UserId:  "200",
-			Balance: 100000,
+		Wallets: []model.Wallet{
+			{
+				Id:      "2",
+				UserId:  "200",
+				Balance: money.New(100000, "IDR"),
+			},
 		},
 	}
 
@@ -522,10 +550,12 @@ func TestSkipAutoCreateUpdate(t *testing.T) {
 			FirstName: "User 300",
 		},
 		Password: "rahasia",
-		Wallet: model.Wallet{
-			Id:      "3",
-			UserId:  "300",
-			Balance: 100000,
+		Wallets: []model.Wallet{
+			{
+				Id:      "3",
+				UserId:  "300",
+				Balance: money.New(100000, "IDR"),
+			},
 		},
 	}
 
@@ -541,10 +571,12 @@ func TestHasMany(t *testing.T) {
 			FirstName: "User 201",
 		},
 		Password: "rahasia",
-		Wallet: model.Wallet{
-			Id:      "4",
-			UserId:  "201",
-			Balance: 100000,
+		Wallets: []model.Wallet{
+			{
+				Id:      "4",
+				UserId:  "201",
+				Balance: money.New(100000, "IDR"),
+			},
 		},
 		Addresses: []model.Address{
 			{
@@ -564,7 +596,7 @@ func TestHasMany(t *testing.T) {
 
 func TestPreloadHasMany(t *testing.T) {
 	var user []model.User
-	err := db.Model(&model.User{}).Preload("Wallet").Preload("Addresses").Find(&user).Error
+	err := db.Model(&model.User{}).Preload("Wallets").Preload("Addresses").Find(&user).Error
 	assert.Nil(t, err)
 }
 
@@ -596,7 +628,7 @@ func TestCreateManyToMany(t *testing.T) {
 	product := model.Product{
 		ID:    "p1",
 		Name:  "product 1",
-		Price: 1000,
+		Price: money.New(1000, "IDR"),
 	}
 
 	err := db.Create(&product).Error
@@ -627,7 +659,7 @@ func TestAssociationFind(t *testing.T) {
 	assert.Nil(t, err)
 
 	var users []model.User
-	err = db.Model(&product).Where("first_name LIKE ?", "%Roy%").Association("LikedByUsers").Find(&users)
+	err = db.Model(&product).Where("first_name_bidx = ?", encryption.BlindIndex("Roy")).Association("LikedByUsers").Find(&users)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(users))
 }
@@ -656,12 +688,16 @@ func TestAssociationReplace(t *testing.T) {
 
 		wallet := model.Wallet{
 			Id:      "w1",
-			UserId:  user.Id,
-			Balance: 5000,
+			UserId:  "1",
+			Balance: money.New(5000, "USD"),
 		}
+		err = tx.Create(&wallet).Error
+		assert.Nil(t, err)
 
-		err = tx.Model(&user).Association("Wallet").Replace(&wallet)
+		// pindahkan wallet ke user lain
+		err = tx.Model(&wallet).Association("User").Replace(&user)
 		assert.Nil(t, err)
+		assert.Equal(t, user.Id, wallet.UserId)
 
 		return nil
 	})
@@ -691,7 +727,7 @@ func TestAssociationClear(t *testing.T) {
 
 func TestPreloadWithCondition(t *testing.T) {
 	var user model.User
-	err := db.Preload("Wallet", "balance > ?", 1000).Take(&user, "id = ?", "1").Error
+	err := db.Preload("Wallets", "balance > ?", 1000).Take(&user, "id = ?", "1").Error
 	assert.Nil(t, err)
 }
 
@@ -719,7 +755,8 @@ func TestJoinQuery(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 5, len(users))
 
-	err = db.Joins("Wallet").Find(&users).Error
+	// left join dengan kondisi currency supaya setiap user paling banyak dapat satu wallet
+	err = db.Joins("LEFT JOIN wallets ON wallets.user_id = users.id AND wallets.currency = ?", money.DefaultCurrency).Find(&users).Error
 	assert.Nil(t, err)
 	assert.Equal(t, 18, len(users))
 }
@@ -730,14 +767,14 @@ func TestJoinQueryCondition(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 4, len(users))
 
-	err = db.Joins("Wallet").Where("balance > ?", 1000).Find(&users).Error
+	err = db.Joins("JOIN wallets ON wallets.user_id = users.id").Where("wallets.balance > ?", 1000).Find(&users).Error
 	assert.Nil(t, err)
 	assert.Equal(t, 4, len(users))
 }
 
 func TestCountAggregation(t *testing.T) {
 	var count int64
-	err := db.Model(&model.User{}).Joins("Wallet").Where("balance > ?", 1000).Count(&count).Error
+	err := db.Model(&model.User{}).Joins("JOIN wallets ON wallets.user_id = users.id").Where("wallets.balance > ?", 1000).Count(&count).Error
 	assert.Nil(t, err)
 	assert.Equal(t, int64(4), count)
 }
@@ -776,20 +813,12 @@ func TestGormWithContext(t *testing.T) {
 	assert.Equal(t, 18, len(users))
 }
 
-func BrokeWalletBalance(db *gorm.DB) *gorm.DB {
-	return db.Where("balance = ?", 0)
-}
-
-func SultanWalletBalance(db *gorm.DB) *gorm.DB {
-	return db.Where("balance > ?", 5000)
-}
-
 func TestScopes(t *testing.T) {
 	var wallets []model.Wallet
-	err := db.Scopes(BrokeWalletBalance).Find(&wallets).Error
+	err := db.Scopes(service.Tier("broke")).Find(&wallets).Error
 	assert.Nil(t, err)
 
-	err = db.Scopes(SultanWalletBalance).Find(&wallets).Error
+	err = db.Scopes(service.Tier("sultan")).Find(&wallets).Error
 	assert.Nil(t, err)
 }
 
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"github.com/dickidarmawansaputra/belajar-gorm/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	total, err := money.New(1000, "IDR").Add(money.New(500, "IDR"))
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(1500, "IDR"), total)
+	assert.Equal(t, "IDR 1500", total.String())
+
+	_, err = money.New(1000, "IDR").Add(money.New(500, "USD"))
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+
+	// 1 USD = 15500.5 IDR
+	rate := big.NewRat(310010, 20)
+	converted, err := money.New(100, "USD").Convert("IDR", rate, money.RoundHalfUp)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15501), converted.Amount)
+
+	converted, err = money.New(100, "USD").Convert("IDR", rate, money.RoundDown)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15500), converted.Amount)
+
+	// banker's rounding: 148.5 jadi 148, 149.5 jadi 150
+	converted, err = money.New(100, "USD").Convert("JPY", big.NewRat(1485, 10), money.RoundHalfEven)
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(148, "JPY"), converted)
+
+	converted, err = money.New(100, "USD").Convert("JPY", big.NewRat(1495, 10), money.RoundHalfEven)
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(150, "JPY"), converted)
+}
+
+func TestExchangeRate(t *testing.T) {
+	err := db.Create(&model.ExchangeRate{
+		BaseCurrency:  "USD",
+		QuoteCurrency: "IDR",
+		Rate:          "15000",
+		EffectiveAt:   time.Now().Add(-time.Hour),
+	}).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	converted, err := service.Convert(ctx, db, money.New(250, "USD"), "IDR", money.RoundHalfUp, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(37500, "IDR"), converted)
+
+	// kebalikan kurs dipakai jika kurs langsung tidak ada
+	converted, err = service.Convert(ctx, db, money.New(37500, "IDR"), "USD", money.RoundHalfUp, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(250, "USD"), converted)
+
+	_, err = service.Convert(ctx, db, money.New(100, "USD"), "JPY", money.RoundHalfUp, time.Now())
+	assert.ErrorIs(t, err, service.ErrRateNotFound)
+}
+
+func TestMultiCurrencyWallet(t *testing.T) {
+	user := model.User{
+		Id:       "940",
+		Password: "rahasia",
+		Name:     model.Name{FirstName: "User 940"},
+		Wallets: []model.Wallet{
+			{Id: "940-idr", UserId: "940"},
+			{Id: "940-usd", UserId: "940", Currency: "USD"},
+		},
+	}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	var found model.User
+	err = db.Preload("Wallets").Take(&found, "id = ?", "940").Error
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(found.Wallets))
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	_, err = walletService.Credit(ctx, "940-usd", 100, "topup", "t1")
+	assert.Nil(t, err)
+
+	_, err = walletService.Transfer(ctx, "940-usd", "940-idr", 100)
+	assert.Equal(t, money.ErrCurrencyMismatch, err)
+
+	// wallet kedua dengan mata uang yang sama ditolak
+	err = db.Create(&model.Wallet{Id: "940-usd-2", UserId: "940", Currency: "USD"}).Error
+	assert.NotNil(t, err)
+
+	// setelah wallet lama di soft delete, wallet baru dengan mata uang yang sama boleh dibuat
+	err = db.Delete(&model.Wallet{Id: "940-usd"}).Error
+	assert.Nil(t, err)
+
+	err = db.Create(&model.Wallet{Id: "940-usd-2", UserId: "940", Currency: "USD"}).Error
+	assert.Nil(t, err)
+}
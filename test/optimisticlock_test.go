@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/optimisticlock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimisticLock(t *testing.T) {
+	todo := model.Todo{
+		UserId: "1",
+		Title:  "optimistic",
+	}
+	err := db.Create(&todo).Error
+	assert.Nil(t, err)
+	assert.Equal(t, optimisticlock.Version(1), todo.Version)
+
+	// dua proses membaca todo yang sama
+	var first, second model.Todo
+	err = db.Take(&first, "id = ?", todo.ID).Error
+	assert.Nil(t, err)
+	err = db.Take(&second, "id = ?", todo.ID).Error
+	assert.Nil(t, err)
+
+	first.Title = "update pertama"
+	err = db.Save(&first).Error
+	assert.Nil(t, err)
+	assert.Equal(t, optimisticlock.Version(2), first.Version)
+
+	// proses kedua masih pegang version lama
+	second.Title = "update kedua"
+	err = db.Save(&second).Error
+	assert.Equal(t, optimisticlock.ErrStaleObject, err)
+	assert.Equal(t, optimisticlock.Version(1), second.Version)
+
+	err = db.Model(&second).Updates(map[string]interface{}{"title": "update kedua"}).Error
+	assert.Equal(t, optimisticlock.ErrStaleObject, err)
+
+	// setelah dibaca ulang update berhasil
+	err = db.Take(&second, "id = ?", todo.ID).Error
+	assert.Nil(t, err)
+	err = db.Model(&second).Updates(map[string]interface{}{"title": "update kedua"}).Error
+	assert.Nil(t, err)
+	assert.Equal(t, optimisticlock.Version(3), second.Version)
+
+	var saved model.Todo
+	err = db.Take(&saved, "id = ?", todo.ID).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "update kedua", saved.Title)
+	assert.Equal(t, optimisticlock.Version(3), saved.Version)
+}
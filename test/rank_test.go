@@ -0,0 +1,42 @@
+package test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/rank"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankBetween(t *testing.T) {
+	key, err := rank.Between("", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "i", key)
+
+	key, err = rank.Between("a", "b")
+	assert.Nil(t, err)
+	assert.True(t, "a" < key && key < "b")
+
+	key, err = rank.Between("", "01")
+	assert.Nil(t, err)
+	assert.True(t, key < "01")
+
+	_, err = rank.Between("b", "a")
+	assert.Equal(t, rank.ErrInvalidRange, err)
+
+	// selalu menyisip di depan tetap menghasilkan rank yang valid dan urut
+	first := "i"
+	for i := 0; i < 100; i++ {
+		key, err = rank.Between("", first)
+		assert.Nil(t, err)
+		assert.True(t, key < first)
+		first = key
+	}
+
+	keys := rank.Spread(1000)
+	assert.True(t, sort.StringsAreSorted(keys))
+	for i := 1; i < len(keys); i++ {
+		assert.NotEqual(t, keys[i-1], keys[i])
+		assert.True(t, len(keys[i]) <= 2)
+	}
+}
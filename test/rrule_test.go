@@ -0,0 +1,68 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/rrule"
+	"github.com/stretchr/testify/assert"
+)
+
+func occurrences(rule rrule.Rule, start time.Time, n int) []string {
+	result := []string{}
+	after := start.Add(-time.Second)
+	for i := 0; i < n; i++ {
+		next, ok := rule.After(start, after)
+		if !ok {
+			break
+		}
+		result = append(result, next.Format("2006-01-02"))
+		after = next
+	}
+	return result
+}
+
+func TestRRuleParse(t *testing.T) {
+	rule, err := rrule.Parse("RRULE:FREQ=WEEKLY;BYDAY=MO,WE;INTERVAL=2;COUNT=5")
+	assert.Nil(t, err)
+	assert.Equal(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=5", rule.String())
+
+	_, err = rrule.Parse("FREQ=HOURLY")
+	assert.ErrorIs(t, err, rrule.ErrUnsupportedRule)
+	_, err = rrule.Parse("FREQ=MONTHLY;BYDAY=-1FR")
+	assert.ErrorIs(t, err, rrule.ErrUnsupportedRule)
+	_, err = rrule.Parse("FREQ=DAILY;COUNT=2;UNTIL=20260101")
+	assert.ErrorIs(t, err, rrule.ErrInvalidRule)
+	_, err = rrule.Parse("INTERVAL=2")
+	assert.ErrorIs(t, err, rrule.ErrInvalidRule)
+}
+
+func TestRRuleOccurrences(t *testing.T) {
+	// jumat 2 januari 2026
+	start := time.Date(2026, time.January, 2, 9, 0, 0, 0, time.Local)
+
+	weekday, _ := rrule.Parse("FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR")
+	assert.Equal(t, []string{"2026-01-02", "2026-01-05", "2026-01-06", "2026-01-07", "2026-01-08", "2026-01-09", "2026-01-12"}, occurrences(weekday, start, 7))
+
+	monthly, _ := rrule.Parse("FREQ=MONTHLY;BYMONTHDAY=15")
+	assert.Equal(t, []string{"2026-01-02", "2026-01-15", "2026-02-15", "2026-03-15"}, occurrences(monthly, start, 4))
+
+	// tanggal 31 dilewati di bulan yang tidak punya tanggal 31
+	endOfMonth := time.Date(2026, time.January, 31, 9, 0, 0, 0, time.Local)
+	monthly, _ = rrule.Parse("FREQ=MONTHLY")
+	assert.Equal(t, []string{"2026-01-31", "2026-03-31", "2026-05-31"}, occurrences(monthly, endOfMonth, 3))
+
+	lastDay, _ := rrule.Parse("FREQ=MONTHLY;BYMONTHDAY=-1")
+	assert.Equal(t, []string{"2026-01-31", "2026-02-28", "2026-03-31"}, occurrences(lastDay, endOfMonth, 3))
+
+	daily, _ := rrule.Parse("FREQ=DAILY;INTERVAL=3;COUNT=3")
+	assert.Equal(t, []string{"2026-01-02", "2026-01-05", "2026-01-08"}, occurrences(daily, start, 10))
+	assert.Equal(t, 2, daily.CountBefore(start, time.Date(2026, time.January, 8, 0, 0, 0, 0, time.Local)))
+
+	until, _ := rrule.Parse("FREQ=WEEKLY;UNTIL=20260116")
+	assert.Equal(t, []string{"2026-01-02", "2026-01-09", "2026-01-16"}, occurrences(until, start, 10))
+
+	leap := time.Date(2028, time.February, 29, 9, 0, 0, 0, time.Local)
+	yearly, _ := rrule.Parse("FREQ=YEARLY")
+	assert.Equal(t, []string{"2028-02-29", "2032-02-29"}, occurrences(yearly, leap, 2))
+}
@@ -0,0 +1,101 @@
+//go:build sqlite_fts5
+
+// go-sqlite3 hanya menyertakan FTS5 dengan build tag, jalankan dengan: go test -tags sqlite_fts5 ./test/
+
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/service"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSearchSQLite(t *testing.T) {
+	sqliteDB, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	assert.Nil(t, err)
+	sqlDB, err := sqliteDB.DB()
+	assert.Nil(t, err)
+	// setiap koneksi in-memory punya database sendiri
+	sqlDB.SetMaxOpenConns(1)
+
+	err = sqliteDB.AutoMigrate(&model.Todo{}, &model.TodoCollaborator{}, &model.GuestBook{})
+	assert.Nil(t, err)
+	err = service.SetupSearch(sqliteDB)
+	assert.Nil(t, err)
+
+	todos := []model.Todo{
+		{UserId: "1", Title: "belanja sayuran", Description: "beli wortel kentang bayam di pasar"},
+		{UserId: "1", Title: "rapat kantor", Description: "bahas anggaran proyek kuartal depan"},
+		{UserId: "1", Title: "laporan proyek", Description: "kirim laporan mingguan proyek ke manajer"},
+		{UserId: "2", Title: "proyek rahasia", Description: "jangan kasih tahu siapapun"},
+	}
+	err = sqliteDB.Create(&todos).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	searchService := service.NewSearchService(sqliteDB)
+
+	result, err := searchService.SearchTodos(ctx, "1", service.SearchQuery{Text: "proyek"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.Total)
+	assert.Equal(t, 2, len(result.Hits))
+	for _, hit := range result.Hits {
+		assert.Contains(t, hit.Snippet, "<mark>proyek</mark>")
+	}
+
+	// todo yang mengandung kedua kata lebih relevan
+	result, err = searchService.SearchTodos(ctx, "1", service.SearchQuery{Text: "laporan proyek"})
+	assert.Nil(t, err)
+	assert.Equal(t, todos[2].ID, result.Hits[0].Id)
+	assert.True(t, result.Hits[0].Score > result.Hits[len(result.Hits)-1].Score)
+
+	result, err = searchService.SearchTodos(ctx, "1", service.SearchQuery{Text: "+proyek -rapat", Mode: service.SearchBoolean})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Total)
+	assert.Equal(t, "laporan proyek", result.Hits[0].Title)
+
+	result, err = searchService.SearchTodos(ctx, "1", service.SearchQuery{Text: "sayur*", Mode: service.SearchBoolean})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Total)
+	assert.Equal(t, todos[0].ID, result.Hits[0].Id)
+
+	result, err = searchService.SearchTodos(ctx, "1", service.SearchQuery{Text: `"laporan mingguan"`, Mode: service.SearchBoolean})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Total)
+
+	// todo yang dihapus permanen ikut keluar dari index lewat trigger
+	err = sqliteDB.Unscoped().Delete(&todos[2]).Error
+	assert.Nil(t, err)
+	result, err = searchService.SearchTodos(ctx, "1", service.SearchQuery{Text: "laporan"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.Total)
+
+	_, err = searchService.SearchTodos(ctx, "1", service.SearchQuery{Text: "-proyek", Mode: service.SearchBoolean})
+	assert.Equal(t, service.ErrInvalidSearchQuery, err)
+
+	guestBooks := []model.GuestBook{
+		{Name: "Budi", Email: "budi@example.com", Message: "<b>terima kasih</b> atas sambutannya"},
+		{Name: "Joko", Email: "joko@example.com", Message: "acara yang sangat meriah"},
+	}
+	err = sqliteDB.Create(&guestBooks).Error
+	assert.Nil(t, err)
+
+	result, err = searchService.SearchGuestBooks(ctx, service.SearchQuery{Text: "terima"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Total)
+	assert.Equal(t, "Budi", result.Hits[0].Title)
+	assert.Contains(t, result.Hits[0].Snippet, "&lt;b&gt;<mark>terima</mark> kasih&lt;/b&gt;")
+
+	// pesan yang diubah ikut diperbarui di index
+	err = sqliteDB.Model(&guestBooks[1]).Update("message", "acara terima tamu").Error
+	assert.Nil(t, err)
+	result, err = searchService.SearchGuestBooks(ctx, service.SearchQuery{Text: "terima"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.Total)
+}
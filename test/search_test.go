@@ -0,0 +1,119 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchTodos(t *testing.T) {
+	for _, id := range []string{"1117", "1118"} {
+		user := model.User{Id: id, Password: "rahasia", Name: model.Name{FirstName: "User " + id}}
+		err := db.Create(&user).Error
+		assert.Nil(t, err)
+	}
+
+	todos := []model.Todo{
+		{UserId: "1117", Title: "belanja sayuran", Description: "beli wortel kentang bayam di pasar"},
+		{UserId: "1117", Title: "rapat kantor", Description: "bahas anggaran proyek kuartal depan"},
+		{UserId: "1117", Title: "laporan proyek", Description: "kirim laporan mingguan proyek ke manajer"},
+		{UserId: "1118", Title: "proyek rahasia", Description: "jangan kasih tahu siapapun"},
+	}
+	err := db.Create(&todos).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	searchService := service.NewSearchService(db)
+
+	result, err := searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: "proyek"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.Total)
+	assert.Equal(t, 2, len(result.Hits))
+	for _, hit := range result.Hits {
+		assert.Contains(t, strings.ToLower(hit.Snippet), "<mark>proyek</mark>")
+	}
+
+	// todo yang mengandung kedua kata lebih relevan
+	result, err = searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: "laporan proyek"})
+	assert.Nil(t, err)
+	assert.Equal(t, todos[2].ID, result.Hits[0].Id)
+	assert.True(t, result.Hits[0].Score > result.Hits[len(result.Hits)-1].Score)
+
+	result, err = searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: "+proyek -rapat", Mode: service.SearchBoolean})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Total)
+	assert.Equal(t, "laporan proyek", result.Hits[0].Title)
+
+	result, err = searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: "sayur*", Mode: service.SearchBoolean})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Total)
+	assert.Equal(t, todos[0].ID, result.Hits[0].Id)
+
+	result, err = searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: `"laporan mingguan"`, Mode: service.SearchBoolean})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Total)
+
+	// todo yang dibagikan ikut dicari
+	err = service.NewTodoService(db).Share(ctx, todos[3].ID, "1117", service.CollaboratorViewer, "1118")
+	assert.Nil(t, err)
+
+	first, err := searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: "proyek", Page: 1, PageSize: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), first.Total)
+	assert.Equal(t, 2, len(first.Hits))
+
+	second, err := searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: "proyek", Page: 2, PageSize: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), second.Total)
+	assert.Equal(t, 1, len(second.Hits))
+	assert.NotContains(t, []uint{first.Hits[0].Id, first.Hits[1].Id}, second.Hits[0].Id)
+
+	// todo yang sudah dihapus tidak ikut dicari
+	err = db.Delete(&todos[2]).Error
+	assert.Nil(t, err)
+	result, err = searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: "laporan"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.Total)
+	assert.Equal(t, 0, len(result.Hits))
+
+	_, err = searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: " !? "})
+	assert.Equal(t, service.ErrEmptySearchQuery, err)
+	_, err = searchService.SearchTodos(ctx, "1117", service.SearchQuery{Text: "-proyek", Mode: service.SearchBoolean})
+	assert.Equal(t, service.ErrInvalidSearchQuery, err)
+}
+
+func TestSearchGuestBooks(t *testing.T) {
+	err := db.Migrator().AutoMigrate(&model.GuestBook{})
+	assert.Nil(t, err)
+
+	// kata unik supaya tidak bentrok dengan data dari test sebelumnya
+	word := fmt.Sprintf("tamu%d", time.Now().UnixNano())
+	guestBooks := []model.GuestBook{
+		{Name: "Budi", Email: "budi@example.com", Message: "<b>İİ</b> " + strings.ToUpper(word) + " terima kasih atas sambutannya"},
+		{Name: "Joko", Email: "joko@example.com", Message: "acara yang sangat meriah"},
+	}
+	err = db.Create(&guestBooks).Error
+	assert.Nil(t, err)
+
+	searchService := service.NewSearchService(db)
+	result, err := searchService.SearchGuestBooks(context.Background(), service.SearchQuery{Text: word})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Total)
+	assert.Equal(t, "Budi", result.Hits[0].Title)
+	// isi pesan di escape, huruf yang panjangnya berubah saat lowercase tidak menggeser posisi mark
+	assert.Contains(t, result.Hits[0].Snippet, "&lt;b&gt;İİ&lt;/b&gt; <mark>"+strings.ToUpper(word)+"</mark> terima")
+	assert.NotContains(t, result.Hits[0].Snippet, "<b>")
+
+	// pesan yang diubah ikut diperbarui di index
+	err = db.Model(&guestBooks[1]).Update("message", "acara "+word+" yang sangat meriah").Error
+	assert.Nil(t, err)
+	result, err = searchService.SearchGuestBooks(context.Background(), service.SearchQuery{Text: word})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.Total)
+}
@@ -0,0 +1,796 @@
+package test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTodoTrash(t *testing.T) {
+	todos := []model.Todo{
+		{UserId: "1100", Title: "todo trash 1"},
+		{UserId: "1100", Title: "todo trash 2"},
+		{UserId: "1100", Title: "todo trash 3"},
+	}
+	err := db.Create(&todos).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	todoService := service.NewTodoService(db)
+
+	err = todoService.Restore(ctx, todos[0].ID, "1100")
+	assert.Equal(t, service.ErrTodoNotTrashed, err)
+	err = todoService.Purge(ctx, todos[0].ID, "1100")
+	assert.Equal(t, service.ErrTodoNotTrashed, err)
+
+	err = db.Delete(&todos).Error
+	assert.Nil(t, err)
+
+	trashed, err := todoService.ListTrashed(ctx, "1100")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(trashed))
+
+	// hanya pemilik yang boleh mengembalikan dan menghapus permanen
+	err = todoService.Restore(ctx, todos[0].ID, "1101")
+	assert.Equal(t, service.ErrTodoNotVisible, err)
+
+	err = todoService.Restore(ctx, todos[0].ID, "1100")
+	assert.Nil(t, err)
+
+	var todo model.Todo
+	err = db.Take(&todo, "id = ?", todos[0].ID).Error
+	assert.Nil(t, err)
+
+	err = todoService.Purge(ctx, todos[1].ID, "1101")
+	assert.Equal(t, service.ErrTodoNotVisible, err)
+	err = todoService.Purge(ctx, todos[1].ID, "1100")
+	assert.Nil(t, err)
+
+	trashed, err = todoService.ListTrashed(ctx, "1100")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(trashed))
+	assert.Equal(t, todos[2].ID, trashed[0].ID)
+}
+
+func TestTodoPurgeTrash(t *testing.T) {
+	var todos []model.Todo
+	for i := 0; i < 5; i++ {
+		todos = append(todos, model.Todo{UserId: "1101", Title: "todo retention"})
+	}
+	err := db.Create(&todos).Error
+	assert.Nil(t, err)
+
+	err = db.Delete(&todos).Error
+	assert.Nil(t, err)
+
+	// 4 todo dihapus 40 hari lalu, 1 todo baru saja dihapus
+	var ids []uint
+	for _, todo := range todos[:4] {
+		ids = append(ids, todo.ID)
+	}
+	err = db.Unscoped().Model(&model.Todo{}).Where("id IN ?", ids).UpdateColumn("deleted_at", time.Now().AddDate(0, 0, -40)).Error
+	assert.Nil(t, err)
+
+	// induk yang sudah lama dihapus tapi subtasknya masih aktif tidak boleh ikut terhapus permanen
+	parent := model.Todo{UserId: "1101", Title: "todo retention induk"}
+	err = db.Create(&parent).Error
+	assert.Nil(t, err)
+	child := model.Todo{UserId: "1101", Title: "todo retention subtask", ParentID: &parent.ID}
+	err = db.Create(&child).Error
+	assert.Nil(t, err)
+	err = db.Model(&parent).UpdateColumn("deleted_at", time.Now().AddDate(0, 0, -40)).Error
+	assert.Nil(t, err)
+
+	todoService := service.NewTodoService(db)
+	report, err := todoService.PurgeTrash(context.Background(), 30*24*time.Hour, 3)
+	assert.Nil(t, err)
+	assert.True(t, report.Purged >= 4)
+	assert.True(t, report.Batches >= 2)
+
+	trashed, err := todoService.ListTrashed(context.Background(), "1101")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(trashed))
+	assert.Equal(t, todos[4].ID, trashed[0].ID)
+	assert.Equal(t, parent.ID, trashed[1].ID)
+
+	err = db.Take(&model.Todo{}, "id = ?", child.ID).Error
+	assert.Nil(t, err)
+
+	err = todoService.Purge(context.Background(), parent.ID, "1101")
+	assert.Equal(t, service.ErrTodoHasSubtasks, err)
+}
+
+func TestTodoTransition(t *testing.T) {
+	todo := model.Todo{UserId: "1102", Title: "todo workflow"}
+	err := db.Create(&todo).Error
+	assert.Nil(t, err)
+	assert.Equal(t, service.TodoOpen, todo.Status)
+
+	ctx := context.Background()
+	todoService := service.NewTodoService(db)
+
+	_, err = todoService.Transition(ctx, todo.ID, service.TodoInProgress, "1102")
+	assert.Nil(t, err)
+
+	// user lain baru boleh mengubah status setelah dibagikan sebagai editor
+	_, err = todoService.Transition(ctx, todo.ID, service.TodoBlocked, "1103")
+	assert.Equal(t, service.ErrTodoNotVisible, err)
+
+	err = db.Create(&model.User{Id: "1103", Password: "rahasia", Name: model.Name{FirstName: "User 1103"}}).Error
+	assert.Nil(t, err)
+	err = todoService.Share(ctx, todo.ID, "1103", service.CollaboratorViewer, "1102")
+	assert.Nil(t, err)
+	_, err = todoService.Transition(ctx, todo.ID, service.TodoBlocked, "1103")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+
+	err = todoService.Share(ctx, todo.ID, "1103", service.CollaboratorEditor, "1102")
+	assert.Nil(t, err)
+	_, err = todoService.Transition(ctx, todo.ID, service.TodoBlocked, "1103")
+	assert.Nil(t, err)
+
+	// blocked tidak bisa langsung done
+	_, err = todoService.Transition(ctx, todo.ID, service.TodoDone, "1102")
+	assert.ErrorIs(t, err, service.ErrInvalidTransition)
+	var transitionErr *service.TransitionError
+	assert.ErrorAs(t, err, &transitionErr)
+	assert.Equal(t, service.TodoBlocked, transitionErr.From)
+
+	_, err = todoService.Transition(ctx, todo.ID, service.TodoInProgress, "1102")
+	assert.Nil(t, err)
+
+	updated, err := todoService.Transition(ctx, todo.ID, service.TodoDone, "1102")
+	assert.Nil(t, err)
+	assert.NotNil(t, updated.CompletedAt)
+
+	// dibuka lagi, completed_at dikosongkan
+	_, err = todoService.Transition(ctx, todo.ID, service.TodoOpen, "1103")
+	assert.Nil(t, err)
+
+	var reopened model.Todo
+	err = db.Take(&reopened, "id = ?", todo.ID).Error
+	assert.Nil(t, err)
+	assert.Equal(t, service.TodoOpen, reopened.Status)
+	assert.Nil(t, reopened.CompletedAt)
+
+	history, err := todoService.StatusHistory(ctx, todo.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(history))
+	assert.Equal(t, service.TodoOpen, history[0].FromStatus)
+	assert.Equal(t, service.TodoBlocked, history[1].ToStatus)
+	assert.Equal(t, "1103", history[1].ActorId)
+	assert.Equal(t, service.TodoDone, history[3].ToStatus)
+}
+
+func TestTodoDueScopes(t *testing.T) {
+	user := model.User{Id: "1104", Password: "rahasia", TimeZone: "Asia/Jayapura", Name: model.Name{FirstName: "User 1104"}}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	now := time.Now()
+	yesterday := now.Add(-24 * time.Hour)
+	soon := now.Add(time.Hour)
+	nextWeek := now.AddDate(0, 0, 7)
+	todos := []model.Todo{
+		{UserId: "1104", Title: "overdue", DueAt: &yesterday, Priority: service.PriorityLow},
+		{UserId: "1104", Title: "overdue selesai", DueAt: &yesterday, Status: service.TodoDone},
+		{UserId: "1104", Title: "sebentar lagi", DueAt: &soon, Priority: service.PriorityHigh},
+		{UserId: "1104", Title: "minggu depan", DueAt: &nextWeek, Priority: service.PriorityHigh},
+		{UserId: "1104", Title: "tanpa tenggat", Priority: service.PriorityMedium},
+	}
+	err = db.Create(&todos).Error
+	assert.Nil(t, err)
+
+	titles := func(todos []model.Todo) []string {
+		result := []string{}
+		for _, todo := range todos {
+			result = append(result, todo.Title)
+		}
+		return result
+	}
+
+	var result []model.Todo
+	err = db.Scopes(service.Overdue(now)).Where("user_id = ?", "1104").Find(&result).Error
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"overdue"}, titles(result))
+
+	err = db.Scopes(service.DueWithin(now, 2*time.Hour)).Where("user_id = ?", "1104").Find(&result).Error
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sebentar lagi"}, titles(result))
+
+	err = db.Scopes(service.ByPriority).Where("user_id = ? AND status = ?", "1104", service.TodoOpen).Find(&result).Error
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sebentar lagi", "minggu depan", "tanpa tenggat", "overdue"}, titles(result))
+
+	// batas hari dihitung di zona waktu user
+	location := user.Location()
+	assert.Equal(t, "Asia/Jayapura", location.String())
+	local := now.In(location)
+	startOfDay := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	endOfDay := startOfDay.Add(24*time.Hour - time.Second)
+	morning := startOfDay.Add(time.Second)
+	today := []model.Todo{
+		{UserId: "1104", Title: "awal hari", DueAt: &morning},
+		{UserId: "1104", Title: "akhir hari", DueAt: &endOfDay},
+	}
+	err = db.Create(&today).Error
+	assert.Nil(t, err)
+
+	err = db.Scopes(service.Today(now, location)).Where("user_id = ? AND title IN ?", "1104", []string{"awal hari", "akhir hari"}).Find(&result).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result))
+
+	err = db.Scopes(service.Today(now.AddDate(0, 0, 1), location)).Where("user_id = ? AND title IN ?", "1104", []string{"awal hari", "akhir hari"}).Find(&result).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(result))
+}
+
+func TestTodoDueReminders(t *testing.T) {
+	due := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	todo := model.Todo{UserId: "1105", Title: "reminder", DueAt: &due}
+	err := db.Create(&todo).Error
+	assert.Nil(t, err)
+
+	todoService := service.NewTodoService(db)
+	reminded := func(todos []model.Todo) bool {
+		for _, item := range todos {
+			if item.ID == todo.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	todos, err := todoService.DueReminders(context.Background(), time.Now(), time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, reminded(todos))
+
+	// dijalankan lagi tidak mengirim reminder yang sama
+	todos, err = todoService.DueReminders(context.Background(), time.Now(), time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, reminded(todos))
+
+	// tenggat diundur, reminder dikirim lagi
+	due = due.Add(15 * time.Minute)
+	err = db.Model(&todo).Update("due_at", due).Error
+	assert.Nil(t, err)
+
+	todos, err = todoService.DueReminders(context.Background(), time.Now(), time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, reminded(todos))
+}
+
+func TestTodoTags(t *testing.T) {
+	todos := []model.Todo{
+		{UserId: "1106", Title: "belanja bulanan"},
+		{UserId: "1106", Title: "bayar listrik"},
+		{UserId: "1106", Title: "laporan kantor"},
+	}
+	err := db.Create(&todos).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	todoService := service.NewTodoService(db)
+
+	err = todoService.Tag(ctx, todos[0].ID, "1106", "rumah", "penting")
+	assert.Nil(t, err)
+	err = todoService.Tag(ctx, todos[1].ID, "1106", "rumah", "rumah ")
+	assert.Nil(t, err)
+	err = todoService.Tag(ctx, todos[2].ID, "1106", "kantor", "penting")
+	assert.Nil(t, err)
+	err = todoService.Tag(ctx, todos[2].ID, "1106", " ")
+	assert.Equal(t, service.ErrEmptyTagName, err)
+
+	titles := func(todos []model.Todo) []string {
+		result := []string{}
+		for _, todo := range todos {
+			result = append(result, todo.Title)
+		}
+		return result
+	}
+
+	result, err := todoService.TodosWithAnyTag(ctx, "1106", "rumah", "kantor")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"belanja bulanan", "bayar listrik", "laporan kantor"}, titles(result))
+
+	result, err = todoService.TodosWithAllTags(ctx, "1106", "rumah", "penting")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"belanja bulanan"}, titles(result))
+	assert.Equal(t, 2, len(result[0].Tags))
+
+	err = todoService.Untag(ctx, todos[0].ID, "1106", "penting")
+	assert.Nil(t, err)
+
+	result, err = todoService.TodosWithAllTags(ctx, "1106", "rumah", "penting")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(result))
+
+	var tags []model.Tag
+	err = db.Where("user_id = ?", "1106").Order("name asc").Find(&tags).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(tags))
+	kantor, penting, rumah := tags[0], tags[1], tags[2]
+
+	err = todoService.RenameTag(ctx, kantor.ID, "penting", "1106")
+	assert.Equal(t, service.ErrTagExists, err)
+
+	err = todoService.RenameTag(ctx, rumah.ID, "keluarga", "1106")
+	assert.Nil(t, err)
+
+	// laporan kantor punya kantor dan penting, setelah merge hanya punya penting
+	err = todoService.MergeTags(ctx, kantor.ID, penting.ID, "1106")
+	assert.Nil(t, err)
+
+	usage, err := todoService.TagUsage(ctx, "1106")
+	assert.Nil(t, err)
+	assert.Equal(t, []service.TagUsage{
+		{TagId: rumah.ID, Name: "keluarga", Todos: 2},
+		{TagId: penting.ID, Name: "penting", Todos: 1},
+	}, usage)
+}
+
+func TestTodoSubtasks(t *testing.T) {
+	root := model.Todo{UserId: "1107", Title: "pindah rumah"}
+	err := db.Create(&root).Error
+	assert.Nil(t, err)
+
+	packing := model.Todo{UserId: "1107", Title: "packing", ParentID: &root.ID}
+	err = db.Create(&packing).Error
+	assert.Nil(t, err)
+
+	subtasks := []model.Todo{
+		{UserId: "1107", Title: "packing dapur", ParentID: &packing.ID, Status: service.TodoDone},
+		{UserId: "1107", Title: "packing kamar", ParentID: &packing.ID},
+		{UserId: "1107", Title: "sewa truk", ParentID: &root.ID, Status: service.TodoDone},
+		{UserId: "1107", Title: "sewa gudang", ParentID: &root.ID, Status: service.TodoCancelled},
+	}
+	err = db.Create(&subtasks).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	todoService := service.NewTodoService(db)
+
+	tree, err := todoService.Tree(ctx, root.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(tree.Subtasks))
+	assert.Equal(t, "packing", tree.Subtasks[0].Todo.Title)
+	assert.Equal(t, 2, len(tree.Subtasks[0].Subtasks))
+	// packing, packing dapur, packing kamar, sewa truk (sewa gudang dibatalkan)
+	assert.Equal(t, 4, tree.Descendants)
+	assert.Equal(t, 2, tree.Completed)
+	assert.Equal(t, 0.5, tree.Subtasks[0].Progress())
+
+	// association has many biasa tetap bisa dipakai
+	var loaded model.Todo
+	err = db.Preload("Subtasks").Take(&loaded, "id = ?", packing.ID).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(loaded.Subtasks))
+
+	// todo tidak bisa dipindah ke bawah turunannya sendiri
+	err = todoService.MoveSubtree(ctx, packing.ID, &subtasks[0].ID, "1107")
+	assert.Equal(t, service.ErrTodoCycle, err)
+	err = todoService.MoveSubtree(ctx, packing.ID, &packing.ID, "1107")
+	assert.Equal(t, service.ErrTodoCycle, err)
+
+	other := model.Todo{UserId: "1108", Title: "todo user lain"}
+	err = db.Create(&other).Error
+	assert.Nil(t, err)
+	err = todoService.MoveSubtree(ctx, packing.ID, &other.ID, "1107")
+	assert.Equal(t, service.ErrTodoNotVisible, err)
+
+	err = todoService.MoveSubtree(ctx, packing.ID, nil, "1107")
+	assert.Nil(t, err)
+
+	tree, err = todoService.Tree(ctx, root.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tree.Subtasks))
+
+	err = todoService.MoveSubtree(ctx, packing.ID, &root.ID, "1107")
+	assert.Nil(t, err)
+
+	// soft delete induk ikut menghapus semua turunannya
+	err = todoService.DeleteSubtree(ctx, packing.ID, "1107")
+	assert.Nil(t, err)
+
+	var count int64
+	err = db.Model(&model.Todo{}).Where("id IN ?", []uint{packing.ID, subtasks[0].ID, subtasks[1].ID}).Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	tree, err = todoService.Tree(ctx, root.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tree.Subtasks))
+
+	err = todoService.Restore(ctx, packing.ID, "1107")
+	assert.Nil(t, err)
+
+	tree, err = todoService.Tree(ctx, root.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, tree.Descendants)
+
+	// packing kamar dikembalikan sendiri, induknya yang masih di tempat sampah tetap dihitung sebagai ancestor
+	err = todoService.DeleteSubtree(ctx, packing.ID, "1107")
+	assert.Nil(t, err)
+	err = todoService.Restore(ctx, subtasks[1].ID, "1107")
+	assert.Nil(t, err)
+	err = todoService.MoveSubtree(ctx, root.ID, &subtasks[1].ID, "1107")
+	assert.Equal(t, service.ErrTodoCycle, err)
+}
+
+func TestTodoMoveSubtreeConcurrent(t *testing.T) {
+	todos := []model.Todo{
+		{UserId: "1120", Title: "todo a"},
+		{UserId: "1120", Title: "todo b"},
+	}
+	err := db.Create(&todos).Error
+	assert.Nil(t, err)
+
+	// a ke bawah b dan b ke bawah a bersamaan, paling banyak satu yang boleh berhasil
+	ctx := context.Background()
+	todoService := service.NewTodoService(db)
+	errs := make([]error, 2)
+	var group sync.WaitGroup
+	for i := range todos {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			errs[i] = todoService.MoveSubtree(ctx, todos[i].ID, &todos[1-i].ID, "1120")
+		}(i)
+	}
+	group.Wait()
+	assert.True(t, errs[0] != nil || errs[1] != nil)
+
+	var moved []model.Todo
+	err = db.Where("user_id = ? AND parent_id IS NOT NULL", "1120").Find(&moved).Error
+	assert.Nil(t, err)
+	assert.True(t, len(moved) <= 1)
+}
+
+func TestTodoRank(t *testing.T) {
+	var todos []model.Todo
+	for _, title := range []string{"a", "b", "c", "d"} {
+		todo := model.Todo{UserId: "1109", Title: title}
+		err := db.Create(&todo).Error
+		assert.Nil(t, err)
+		todos = append(todos, todo)
+	}
+
+	ctx := context.Background()
+	todoService := service.NewTodoService(db)
+	order := func() string {
+		var result []model.Todo
+		err := db.Scopes(service.ByRank).Where("user_id = ?", "1109").Find(&result).Error
+		assert.Nil(t, err)
+		titles := ""
+		for _, todo := range result {
+			titles += todo.Title
+		}
+		return titles
+	}
+	assert.Equal(t, "abcd", order())
+
+	err := todoService.MoveBefore(ctx, todos[3].ID, todos[1].ID, "1109")
+	assert.Nil(t, err)
+	assert.Equal(t, "adbc", order())
+
+	err = todoService.MoveAfter(ctx, todos[0].ID, todos[2].ID, "1109")
+	assert.Nil(t, err)
+	assert.Equal(t, "dbca", order())
+
+	err = todoService.MoveToTop(ctx, todos[2].ID, "1109")
+	assert.Nil(t, err)
+	assert.Equal(t, "cdba", order())
+
+	other := model.Todo{UserId: "1110", Title: "todo user lain"}
+	err = db.Create(&other).Error
+	assert.Nil(t, err)
+	err = todoService.MoveBefore(ctx, todos[0].ID, other.ID, "1109")
+	assert.Equal(t, service.ErrRankAnchorNotFound, err)
+
+	// sisipkan berulang di posisi yang sama sampai ranknya panjang lalu rebalance
+	maxRankLength := service.MaxRankLength
+	service.MaxRankLength = 4
+	defer func() { service.MaxRankLength = maxRankLength }()
+	for i := 0; i < 40; i++ {
+		err = todoService.MoveAfter(ctx, todos[i%2].ID, todos[2].ID, "1109")
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, "cbad", order())
+
+	var longest int
+	err = db.Model(&model.Todo{}).Select("max(length(rank_key))").Where("user_id = ?", "1109").Scan(&longest).Error
+	assert.Nil(t, err)
+	assert.True(t, longest > service.MaxRankLength)
+
+	rebalanced, err := todoService.RebalanceRanks(ctx)
+	assert.Nil(t, err)
+	assert.True(t, rebalanced >= 1)
+	assert.Equal(t, "cbad", order())
+
+	err = db.Model(&model.Todo{}).Select("max(length(rank_key))").Where("user_id = ?", "1109").Scan(&longest).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 1, longest)
+
+	// rank kembar (misalnya dari data lama) diperbaiki saat todo dipindah
+	err = db.Model(&model.Todo{}).Where("user_id = ?", "1109").UpdateColumn("rank_key", "").Error
+	assert.Nil(t, err)
+	err = todoService.MoveToTop(ctx, todos[3].ID, "1109")
+	assert.Nil(t, err)
+
+	var result []model.Todo
+	err = db.Scopes(service.ByRank).Where("user_id = ?", "1109").Find(&result).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "d", result[0].Title)
+}
+
+func TestTodoRankConcurrent(t *testing.T) {
+	var todos []model.Todo
+	for i := 0; i < 5; i++ {
+		todo := model.Todo{UserId: "1111", Title: "todo rank"}
+		err := db.Create(&todo).Error
+		assert.Nil(t, err)
+		todos = append(todos, todo)
+	}
+
+	todoService := service.NewTodoService(db)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := todoService.MoveBefore(context.Background(), todos[i%5].ID, todos[(i+2)%5].ID, "1111")
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// perpindahan berjalan bergantian sehingga tidak ada rank yang kembar
+	var ranks []string
+	err := db.Model(&model.Todo{}).Where("user_id = ?", "1111").Distinct("rank_key").Pluck("rank_key", &ranks).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(ranks))
+}
+
+func TestTodoRankCreateConcurrent(t *testing.T) {
+	first := model.Todo{UserId: "1119", Title: "todo pertama"}
+	err := db.Create(&first).Error
+	assert.Nil(t, err)
+
+	// todo dalam satu batch create juga dapat rank berbeda
+	batch := []model.Todo{{UserId: "1119", Title: "batch 1"}, {UserId: "1119", Title: "batch 2"}}
+	err = db.Create(&batch).Error
+	assert.Nil(t, err)
+	assert.True(t, first.Rank < batch[0].Rank)
+	assert.True(t, batch[0].Rank < batch[1].Rank)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := db.Create(&model.Todo{UserId: "1119", Title: "todo " + strconv.Itoa(i)}).Error
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	var ranks []string
+	err = db.Model(&model.Todo{}).Where("user_id = ?", "1119").Distinct("rank_key").Pluck("rank_key", &ranks).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 13, len(ranks))
+}
+
+func TestTodoRecurrence(t *testing.T) {
+	ctx := context.Background()
+	todoService := service.NewTodoService(db)
+
+	noDue := model.Todo{UserId: "1112", Title: "tanpa tenggat"}
+	err := db.Create(&noDue).Error
+	assert.Nil(t, err)
+	err = todoService.SetRecurrence(ctx, noDue.ID, "FREQ=DAILY", "1112")
+	assert.Equal(t, service.ErrRecurrenceNeedsDueAt, err)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	root := model.Todo{UserId: "1112", Title: "olahraga", DueAt: &start}
+	err = db.Create(&root).Error
+	assert.Nil(t, err)
+
+	err = todoService.SetRecurrence(ctx, root.ID, "FREQ=DAILY", "1112")
+	assert.Nil(t, err)
+
+	// selesai, occurrence berikutnya dibuat
+	_, err = todoService.Transition(ctx, root.ID, service.TodoDone, "1112")
+	assert.Nil(t, err)
+
+	var series []model.Todo
+	loadSeries := func(rootId uint) {
+		series = nil
+		err := db.Where("id = ? OR recurrence_parent_id = ?", rootId, rootId).Order("due_at asc").Find(&series).Error
+		assert.Nil(t, err)
+	}
+	loadSeries(root.ID)
+	assert.Equal(t, 2, len(series))
+	assert.Equal(t, start.AddDate(0, 0, 1), series[1].DueAt.In(start.Location()))
+	assert.Equal(t, root.ID, *series[1].RecurrenceParentID)
+	assert.Equal(t, "olahraga", series[1].Title)
+
+	// aturan hanya bisa diset di todo pertama seri
+	err = todoService.SetRecurrence(ctx, series[1].ID, "FREQ=WEEKLY", "1112")
+	assert.Equal(t, service.ErrRecurrenceNotRoot, err)
+
+	// dibatalkan juga lanjut ke occurrence berikutnya
+	_, err = todoService.Transition(ctx, series[1].ID, service.TodoCancelled, "1112")
+	assert.Nil(t, err)
+
+	// user lain tidak bisa menambah occurrence ke seri milik orang lain
+	_, err = todoService.Materialize(ctx, root.ID, 3, time.Now(), "1")
+	assert.Equal(t, service.ErrTodoNotVisible, err)
+
+	created, err := todoService.Materialize(ctx, root.ID, 3, time.Now(), "1112")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(created))
+
+	loadSeries(root.ID)
+	assert.Equal(t, 5, len(series))
+	third, fourth := series[3], series[4]
+
+	// mengubah aturan hanya untuk satu occurrence tidak diizinkan
+	rule := "FREQ=WEEKLY"
+	err = todoService.EditOccurrence(ctx, third.ID, service.TodoChanges{Recurrence: &rule}, service.EditThisOccurrence, "1112")
+	assert.Equal(t, service.ErrRecurrenceEditScope, err)
+
+	title := "olahraga pagi"
+	err = todoService.EditOccurrence(ctx, third.ID, service.TodoChanges{Title: &title}, service.EditThisOccurrence, "1112")
+	assert.Nil(t, err)
+	loadSeries(root.ID)
+	assert.Equal(t, "olahraga pagi", series[3].Title)
+	assert.Equal(t, "olahraga", series[4].Title)
+
+	// semua occurrence berikutnya, seri dipecah di occurrence ketiga
+	title = "lari"
+	err = todoService.EditOccurrence(ctx, third.ID, service.TodoChanges{Title: &title}, service.EditAllFuture, "1112")
+	assert.Nil(t, err)
+
+	var loaded model.Todo
+	err = db.Preload("Occurrences").Take(&loaded, "id = ?", root.ID).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(loaded.Occurrences))
+	assert.Contains(t, loaded.Recurrence, "UNTIL=")
+	assert.Equal(t, "olahraga", loaded.Occurrences[0].Title)
+
+	var split model.Todo
+	err = db.Preload("Occurrences").Take(&split, "id = ?", third.ID).Error
+	assert.Nil(t, err)
+	assert.Nil(t, split.RecurrenceParentID)
+	assert.Equal(t, "FREQ=DAILY", split.Recurrence)
+	assert.Equal(t, "lari", split.Title)
+	assert.Equal(t, 1, len(split.Occurrences))
+	assert.Equal(t, fourth.ID, split.Occurrences[0].ID)
+	assert.Equal(t, "lari", split.Occurrences[0].Title)
+
+	// aturan baru, occurrence lama yang belum dikerjakan diganti
+	err = todoService.EditOccurrence(ctx, third.ID, service.TodoChanges{Recurrence: &rule}, service.EditAllFuture, "1112")
+	assert.Nil(t, err)
+
+	created, err = todoService.Materialize(ctx, third.ID, 2, time.Now(), "1112")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(created))
+	assert.Equal(t, third.DueAt.AddDate(0, 0, 7), created[0].DueAt.In(third.DueAt.Location()))
+
+	loadSeries(third.ID)
+	assert.Equal(t, 2, len(series))
+
+	// occurrence lama masuk tempat sampah, bukan dihapus permanen
+	var replaced model.Todo
+	err = db.Unscoped().Take(&replaced, "id = ?", fourth.ID).Error
+	assert.Nil(t, err)
+	assert.True(t, replaced.DeletedAt.Valid)
+	assert.Nil(t, replaced.RecurrenceParentID)
+}
+
+func TestTodoCollaborators(t *testing.T) {
+	for _, id := range []string{"1113", "1114", "1115", "1116"} {
+		user := model.User{Id: id, Password: "rahasia", Name: model.Name{FirstName: "User " + id}}
+		err := db.Create(&user).Error
+		assert.Nil(t, err)
+	}
+
+	todos := []model.Todo{
+		{UserId: "1113", Title: "rencana liburan"},
+		{UserId: "1113", Title: "daftar belanja"},
+		{UserId: "1114", Title: "todo milik 1114"},
+	}
+	err := db.Create(&todos).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	todoService := service.NewTodoService(db)
+
+	err = todoService.Share(ctx, todos[0].ID, "1114", service.CollaboratorEditor, "1113")
+	assert.Nil(t, err)
+	err = todoService.Share(ctx, todos[0].ID, "1115", service.CollaboratorViewer, "1113")
+	assert.Nil(t, err)
+	err = todoService.Share(ctx, todos[1].ID, "1115", service.CollaboratorViewer, "1113")
+	assert.Nil(t, err)
+
+	err = todoService.Share(ctx, todos[0].ID, "1116", service.CollaboratorViewer, "1114")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+	err = todoService.Share(ctx, todos[0].ID, "1113", service.CollaboratorViewer, "1113")
+	assert.Equal(t, service.ErrShareWithOwner, err)
+	err = todoService.Share(ctx, todos[0].ID, "1116", "admin", "1113")
+	assert.Equal(t, service.ErrInvalidRole, err)
+
+	var visible []model.Todo
+	err = db.Scopes(service.VisibleTo("1114")).Order("id asc").Find(&visible).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(visible))
+
+	visible, err = todoService.ListVisible(ctx, "1115")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(visible))
+
+	// collaborator beserta usernya dimuat dengan preload bertingkat
+	visible, err = todoService.ListVisible(ctx, "1113")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(visible))
+	for _, todo := range visible {
+		for _, collaborator := range todo.Collaborators {
+			assert.NotNil(t, collaborator.User)
+			assert.Equal(t, "User "+collaborator.UserId, collaborator.User.Name.FirstName)
+		}
+	}
+
+	title := "rencana liburan ke bali"
+	err = todoService.EditOccurrence(ctx, todos[0].ID, service.TodoChanges{Title: &title}, service.EditThisOccurrence, "1114")
+	assert.Nil(t, err)
+	err = todoService.EditOccurrence(ctx, todos[0].ID, service.TodoChanges{Title: &title}, service.EditThisOccurrence, "1115")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+	err = todoService.EditOccurrence(ctx, todos[0].ID, service.TodoChanges{Title: &title}, service.EditThisOccurrence, "1116")
+	assert.Equal(t, service.ErrTodoNotVisible, err)
+
+	err = todoService.DeleteSubtree(ctx, todos[0].ID, "1114")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+
+	// setiap perubahan lain juga dicek rolenya
+	err = todoService.Tag(ctx, todos[0].ID, "1114", "liburan")
+	assert.Nil(t, err)
+	err = todoService.Tag(ctx, todos[0].ID, "1115", "liburan")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+	_, err = todoService.Transition(ctx, todos[0].ID, service.TodoInProgress, "1115")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+	err = todoService.MoveToTop(ctx, todos[0].ID, "1114")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+	rule := "FREQ=DAILY"
+	err = todoService.SetRecurrence(ctx, todos[0].ID, rule, "1114")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+	err = todoService.EditOccurrence(ctx, todos[0].ID, service.TodoChanges{Recurrence: &rule}, service.EditAllFuture, "1114")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+
+	// role diganti, viewer menjadi editor
+	err = todoService.Share(ctx, todos[0].ID, "1115", service.CollaboratorEditor, "1113")
+	assert.Nil(t, err)
+	err = todoService.EditOccurrence(ctx, todos[0].ID, service.TodoChanges{Title: &title}, service.EditThisOccurrence, "1115")
+	assert.Nil(t, err)
+
+	// collaborator bisa keluar sendiri
+	err = todoService.Unshare(ctx, todos[0].ID, "1114", "1115")
+	assert.Equal(t, service.ErrTodoForbidden, err)
+	err = todoService.Unshare(ctx, todos[0].ID, "1114", "1114")
+	assert.Nil(t, err)
+	err = todoService.EditOccurrence(ctx, todos[0].ID, service.TodoChanges{Title: &title}, service.EditThisOccurrence, "1114")
+	assert.Equal(t, service.ErrTodoNotVisible, err)
+	err = db.Scopes(service.VisibleTo("1114")).Find(&visible).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(visible))
+
+	err = todoService.DeleteSubtree(ctx, todos[0].ID, "1113")
+	assert.Nil(t, err)
+	visible, err = todoService.ListVisible(ctx, "1115")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(visible))
+}
@@ -0,0 +1,389 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"github.com/dickidarmawansaputra/belajar-gorm/service"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// user dengan satu wallet dan satu address, setiap test memakai id sendiri supaya bisa dijalankan terpisah
+func createUserWithWallet(t *testing.T, id string) {
+	user := model.User{
+		Id:       id,
+		Password: "rahasia",
+		Name: model.Name{
+			FirstName: "User " + id,
+		},
+		Wallets: []model.Wallet{
+			{
+				Id:      id,
+				UserId:  id,
+				Balance: money.New(1000, "IDR"),
+			},
+		},
+		Addresses: []model.Address{
+			{UserId: id, Address: "A"},
+		},
+	}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+}
+
+func TestDeactivateUser(t *testing.T) {
+	createUserWithWallet(t, "400")
+
+	userService := service.NewUserService(db)
+	err := userService.DeactivateUser(context.Background(), "400")
+	assert.Nil(t, err)
+
+	var count int64
+	err = db.Model(&model.User{}).Where("id = ?", "400").Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	err = db.Model(&model.Wallet{}).Where("user_id = ?", "400").Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	var addresses []model.Address
+	err = db.Preload("User").Find(&addresses, "user_id = ?", "400").Error
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(addresses))
+
+	// wallet yang masih aktif tidak ikut memuat user yang sudah dinonaktifkan
+	createUserWithWallet(t, "401")
+	err = db.Delete(&model.User{Id: "401"}).Error
+	assert.Nil(t, err)
+
+	var wallet model.Wallet
+	err = db.Preload("User").Take(&wallet, "id = ?", "401").Error
+	assert.Nil(t, err)
+	assert.Nil(t, wallet.User)
+}
+
+func TestReactivateUser(t *testing.T) {
+	createUserWithWallet(t, "402")
+
+	ctx := context.Background()
+	userService := service.NewUserService(db)
+	err := userService.DeactivateUser(ctx, "402")
+	assert.Nil(t, err)
+
+	err = userService.ReactivateUser(ctx, "402")
+	assert.Nil(t, err)
+
+	var user model.User
+	err = db.Preload("Wallets").Preload("Addresses").Take(&user, "id = ?", "402").Error
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(user.Wallets))
+	assert.Equal(t, "402", user.Wallets[0].Id)
+	assert.Equal(t, 1, len(user.Addresses))
+
+	var wallet model.Wallet
+	err = db.Preload("User").Take(&wallet, "id = ?", "402").Error
+	assert.Nil(t, err)
+	assert.NotNil(t, wallet.User)
+
+	// user yang aktif tidak bisa diaktifkan lagi
+	err = userService.ReactivateUser(ctx, "402")
+	assert.Equal(t, gorm.ErrRecordNotFound, err)
+}
+
+func TestEraseUser(t *testing.T) {
+	user := model.User{
+		Id:       "500",
+		Password: "rahasia",
+		Name: model.Name{
+			FirstName: "User 500",
+		},
+		Addresses: []model.Address{
+			{UserId: "500", Address: "Jalan Rahasia"},
+		},
+	}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	todo := model.Todo{UserId: "500", Title: "todo 500"}
+	err = db.Create(&todo).Error
+	assert.Nil(t, err)
+
+	err = service.NewTodoService(db).Tag(context.Background(), todo.ID, "500", "rahasia")
+	assert.Nil(t, err)
+
+	err = db.Create(&model.UserLog{UserId: "500", Action: "login"}).Error
+	assert.Nil(t, err)
+
+	// jejak user di todo, wallet dan transfer terjadwal milik user lain
+	ctx := context.Background()
+	other := model.User{Id: "501", Password: "rahasia", Name: model.Name{FirstName: "User 501"}}
+	err = db.Create(&other).Error
+	assert.Nil(t, err)
+	for _, id := range []string{"500", "501"} {
+		err = db.Create(&model.Wallet{Id: id, UserId: id}).Error
+		assert.Nil(t, err)
+	}
+
+	walletService := service.NewWalletService(db)
+	_, err = walletService.Credit(ctx, "500", 1000, "topup", "t1")
+	assert.Nil(t, err)
+	err = walletService.FreezeWallet(ctx, "501", "500", "laporan dari user 500")
+	assert.Nil(t, err)
+
+	todoService := service.NewTodoService(db)
+	shared := model.Todo{UserId: "501", Title: "todo 501"}
+	err = db.Create(&shared).Error
+	assert.Nil(t, err)
+	err = todoService.Share(ctx, shared.ID, "500", service.CollaboratorEditor, "501")
+	assert.Nil(t, err)
+	_, err = todoService.Transition(ctx, shared.ID, service.TodoDone, "500")
+	assert.Nil(t, err)
+
+	scheduled, err := service.NewTransferScheduler(db).Schedule(ctx, "500", "501", money.New(100, "IDR"), "monthly:1", time.Now())
+	assert.Nil(t, err)
+	err = db.Create(&model.ScheduledTransferRun{ScheduledTransferId: scheduled.ID, ScheduledAt: scheduled.NextRunAt, Status: service.RunSucceeded}).Error
+	assert.Nil(t, err)
+
+	userService := service.NewUserService(db)
+	report, err := userService.EraseUser(context.Background(), "500")
+	assert.Nil(t, err)
+	assert.True(t, report.Verified)
+
+	traces := []struct {
+		model  interface{}
+		column string
+	}{
+		{&model.TodoStatusChange{}, "actor_id"},
+		{&model.WalletTierChange{}, "user_id"},
+		{&model.WalletStatusChange{}, "actor"},
+	}
+	for _, trace := range traces {
+		var count int64
+		err = db.Model(trace.model).Where(trace.column+" = ?", "500").Count(&count).Error
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), count)
+
+		err = db.Model(trace.model).Where(trace.column+" = ?", service.Pseudonym("500")).Count(&count).Error
+		assert.Nil(t, err)
+		assert.True(t, count > 0)
+	}
+
+	var count int64
+	err = db.Model(&model.UserLog{}).Where("user_id = ?", service.Pseudonym("500")).Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	err = db.Unscoped().Model(&model.Todo{}).Where("user_id = ?", "500").Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	err = db.Model(&model.Tag{}).Where("user_id = ?", "500").Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	err = db.Model(&model.ScheduledTransfer{}).Where("from_wallet_id = ?", "500").Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	var erased model.User
+	err = db.Unscoped().Take(&erased, "id = ?", "500").Error
+	assert.Nil(t, err)
+	assert.Equal(t, "", erased.Name.FirstName)
+	assert.Equal(t, "", erased.Password)
+	assert.True(t, erased.DeletedAt.Valid)
+
+	// erase kedua kali tidak error dan tetap terverifikasi
+	report, err = userService.EraseUser(context.Background(), "500")
+	assert.Nil(t, err)
+	assert.True(t, report.Verified)
+}
+
+func TestExportUser(t *testing.T) {
+	user := model.User{
+		Id:       "600",
+		Password: "rahasia",
+		Name: model.Name{
+			FirstName: "User 600",
+		},
+		Wallets: []model.Wallet{
+			{
+				Id:      "600",
+				UserId:  "600",
+				Balance: money.New(1000, "IDR"),
+			},
+		},
+	}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	todo := model.Todo{UserId: "600", Title: "todo 600"}
+	err = db.Create(&todo).Error
+	assert.Nil(t, err)
+
+	err = db.Delete(&todo).Error
+	assert.Nil(t, err)
+
+	err = db.Create(&model.Todo{UserId: "600", Title: "todo 600 kedua"}).Error
+	assert.Nil(t, err)
+	err = db.Create(&model.Tag{UserId: "600", Name: "kerja"}).Error
+	assert.Nil(t, err)
+
+	// setiap section dibaca per halaman, dikecilkan supaya paging ikut teruji
+	batchSize := service.ExportBatchSize
+	service.ExportBatchSize = 1
+	defer func() { service.ExportBatchSize = batchSize }()
+
+	// todo user lain yang dibagikan ke user ikut diexport
+	err = db.Create(&model.User{Id: "601", Password: "rahasia", Name: model.Name{FirstName: "User 601"}}).Error
+	assert.Nil(t, err)
+	shared := model.Todo{UserId: "601", Title: "todo 601"}
+	err = db.Create(&shared).Error
+	assert.Nil(t, err)
+	err = db.Create(&model.TodoCollaborator{TodoId: shared.ID, UserId: "600", Role: service.CollaboratorViewer}).Error
+	assert.Nil(t, err)
+
+	var buffer bytes.Buffer
+	userService := service.NewUserService(db)
+	err = userService.ExportUser(context.Background(), "600", &buffer)
+	assert.Nil(t, err)
+	assert.NotContains(t, buffer.String(), "rahasia")
+
+	var export service.UserExport
+	err = json.Unmarshal(buffer.Bytes(), &export)
+	assert.Nil(t, err)
+	assert.Equal(t, service.ExportVersion, export.Version)
+	assert.Equal(t, "User 600", export.User.FirstName)
+	assert.Equal(t, int64(1000), export.Wallets[0].Balance)
+	assert.Equal(t, "IDR", export.Wallets[0].Currency)
+	assert.Equal(t, 2, len(export.Todos))
+	assert.NotNil(t, export.Todos[0].DeletedAt)
+	assert.Equal(t, "todo 600 kedua", export.Todos[1].Title)
+	assert.Equal(t, 1, len(export.Shares))
+	assert.Equal(t, "todo 601", export.Shares[0].TodoTitle)
+	assert.Equal(t, service.CollaboratorViewer, export.Shares[0].Role)
+	assert.Equal(t, 1, len(export.Tags))
+	assert.Equal(t, "kerja", export.Tags[0].Name)
+}
+
+func TestMergeUsers(t *testing.T) {
+	users := []model.User{
+		{
+			Id:       "700",
+			Password: "rahasia",
+			Name:     model.Name{FirstName: "User 700"},
+			Wallets:  []model.Wallet{{Id: "700", UserId: "700", Balance: money.New(1000, "IDR")}},
+		},
+		{
+			Id:        "701",
+			Password:  "rahasia",
+			Name:      model.Name{FirstName: "User 700"},
+			Wallets:   []model.Wallet{{Id: "701", UserId: "701", Balance: money.New(500, "IDR")}},
+			Addresses: []model.Address{{UserId: "701", Address: "A"}},
+		},
+	}
+	err := db.Create(&users).Error
+	assert.Nil(t, err)
+
+	err = db.Create(&model.Product{ID: "p700", Name: "product 700", Price: money.New(1000, "IDR")}).Error
+	assert.Nil(t, err)
+
+	// kedua user menyukai product yang sama
+	for _, userId := range []string{"700", "701"} {
+		err = db.Table("user_like_product").Create(map[string]interface{}{
+			"user_id":    userId,
+			"product_id": "p700",
+		}).Error
+		assert.Nil(t, err)
+	}
+
+	// todo user lain dibagikan ke kedua user, dan todo 700 dibagikan ke 701
+	err = db.Create(&model.User{Id: "702", Password: "rahasia", Name: model.Name{FirstName: "User 702"}}).Error
+	assert.Nil(t, err)
+	todos := []model.Todo{
+		{UserId: "702", Title: "todo bersama"},
+		{UserId: "702", Title: "todo untuk 701"},
+		{UserId: "700", Title: "todo 700"},
+	}
+	err = db.Create(&todos).Error
+	assert.Nil(t, err)
+	err = db.Create(&[]model.TodoCollaborator{
+		{TodoId: todos[0].ID, UserId: "700", Role: service.CollaboratorViewer},
+		{TodoId: todos[0].ID, UserId: "701", Role: service.CollaboratorEditor},
+		{TodoId: todos[1].ID, UserId: "701", Role: service.CollaboratorViewer},
+		{TodoId: todos[2].ID, UserId: "701", Role: service.CollaboratorEditor},
+	}).Error
+	assert.Nil(t, err)
+
+	// tag dengan nama yang sama digabung, tag lain dipindah
+	todoService := service.NewTodoService(db)
+	dropTodo := model.Todo{UserId: "701", Title: "todo 701"}
+	err = db.Create(&dropTodo).Error
+	assert.Nil(t, err)
+	err = todoService.Tag(context.Background(), todos[2].ID, "700", "penting")
+	assert.Nil(t, err)
+	err = todoService.Tag(context.Background(), dropTodo.ID, "701", "penting", "rumah")
+	assert.Nil(t, err)
+
+	userService := service.NewUserService(db)
+	summary, err := userService.MergeUsers(context.Background(), "700", "701")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), summary.AddressesMoved)
+	assert.Equal(t, int64(500), summary.BalanceMerged["IDR"])
+	assert.Equal(t, int64(0), summary.LikesMerged)
+	assert.Equal(t, int64(1), summary.SharesMoved)
+	assert.Equal(t, int64(2), summary.TagsMerged)
+
+	var merged model.Todo
+	err = db.Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name asc")
+	}).Take(&merged, "id = ?", dropTodo.ID).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(merged.Tags))
+	for _, tag := range merged.Tags {
+		assert.Equal(t, "700", tag.UserId)
+	}
+	// todo 701 ditaruh di bawah list 700, rank tidak kembar walau sebelumnya sama-sama todo pertama
+	var ranked []model.Todo
+	err = db.Scopes(service.ByRank).Where("user_id = ?", "700").Find(&ranked).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ranked))
+	assert.Equal(t, "todo 700", ranked[0].Title)
+	assert.Equal(t, "todo 701", ranked[1].Title)
+	assert.True(t, ranked[0].Rank < ranked[1].Rank)
+
+	usage, err := todoService.TagUsage(context.Background(), "700")
+	assert.Nil(t, err)
+	assert.Equal(t, []service.TagUsage{{TagId: usage[0].TagId, Name: "penting", Todos: 2}, {TagId: usage[1].TagId, Name: "rumah", Todos: 1}}, usage)
+
+	var shares []model.TodoCollaborator
+	err = db.Where("todo_id IN ?", []uint{todos[0].ID, todos[1].ID, todos[2].ID}).Order("todo_id asc").Find(&shares).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(shares))
+	// role tertinggi dipakai, dan todo 700 tidak lagi dibagikan ke pemiliknya sendiri
+	assert.Equal(t, todos[0].ID, shares[0].TodoId)
+	assert.Equal(t, "700", shares[0].UserId)
+	assert.Equal(t, service.CollaboratorEditor, shares[0].Role)
+	assert.Equal(t, todos[1].ID, shares[1].TodoId)
+	assert.Equal(t, "700", shares[1].UserId)
+
+	var user model.User
+	err = db.Preload("Wallets").Preload("Addresses").Preload("LikeProducts").Take(&user, "id = ?", "700").Error
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(user.Wallets))
+	assert.Equal(t, money.New(1500, "IDR"), user.Wallets[0].Balance)
+	assert.Equal(t, 1, len(user.Addresses))
+	assert.Equal(t, 1, len(user.LikeProducts))
+
+	err = db.Take(&model.User{}, "id = ?", "701").Error
+	assert.Equal(t, gorm.ErrRecordNotFound, err)
+
+	_, err = userService.MergeUsers(context.Background(), "700", "700")
+	assert.Equal(t, service.ErrMergeSameUser, err)
+}
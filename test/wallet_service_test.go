@@ -0,0 +1,632 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dickidarmawansaputra/belajar-gorm/model"
+	"github.com/dickidarmawansaputra/belajar-gorm/money"
+	"github.com/dickidarmawansaputra/belajar-gorm/service"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestWalletCreditDebit(t *testing.T) {
+	user := model.User{
+		Id:       "900",
+		Password: "rahasia",
+		Name: model.Name{
+			FirstName: "User 900",
+		},
+		Wallets: []model.Wallet{{
+			Id:     "900",
+			UserId: "900",
+		}},
+	}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+
+	entry, err := walletService.Credit(ctx, "900", 1000, "topup", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(1000, "IDR"), entry.BalanceAfter)
+
+	entry, err = walletService.Debit(ctx, "900", 300, "purchase", "o1")
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(-300, "IDR"), entry.Amount)
+	assert.Equal(t, money.New(700, "IDR"), entry.BalanceAfter)
+
+	_, err = walletService.Debit(ctx, "900", 5000, "purchase", "o2")
+	assert.Equal(t, service.ErrInsufficientBalance, err)
+
+	_, err = walletService.Credit(ctx, "900", -1, "topup", "t2")
+	assert.Equal(t, service.ErrInvalidAmount, err)
+
+	var wallet model.Wallet
+	err = db.Take(&wallet, "id = ?", "900").Error
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(700, "IDR"), wallet.Balance)
+
+	// balance yang diubah langsung bisa dihitung ulang dari ledger
+	err = db.Model(&wallet).UpdateColumn("balance", 99).Error
+	assert.Nil(t, err)
+
+	balance, err := walletService.RebuildBalance(ctx, "900")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(700), balance)
+}
+
+func TestTransfer(t *testing.T) {
+	users := []model.User{
+		{Id: "910", Password: "rahasia", Name: model.Name{FirstName: "User 910"}, Wallets: []model.Wallet{{Id: "910", UserId: "910"}}},
+		{Id: "911", Password: "rahasia", Name: model.Name{FirstName: "User 911"}, Wallets: []model.Wallet{{Id: "911", UserId: "911"}}},
+	}
+	err := db.Create(&users).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	_, err = walletService.Credit(ctx, "910", 1000, "topup", "t1")
+	assert.Nil(t, err)
+
+	result, err := walletService.Transfer(ctx, "910", "911", 400)
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(600, "IDR"), result.Debit.BalanceAfter)
+	assert.Equal(t, money.New(400, "IDR"), result.Credit.BalanceAfter)
+	assert.Equal(t, result.Debit.ReferenceId, result.Credit.ReferenceId)
+
+	_, err = walletService.Transfer(ctx, "911", "910", 401)
+	assert.Equal(t, service.ErrInsufficientBalance, err)
+
+	_, err = walletService.Transfer(ctx, "910", "910", 1)
+	assert.Equal(t, service.ErrSameWallet, err)
+}
+
+func TestTransferConcurrent(t *testing.T) {
+	ids := []string{"920", "921", "922", "923"}
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	for _, id := range ids {
+		user := model.User{Id: id, Password: "rahasia", Name: model.Name{FirstName: "User " + id}, Wallets: []model.Wallet{{Id: id, UserId: id}}}
+		err := db.Create(&user).Error
+		assert.Nil(t, err)
+
+		_, err = walletService.Credit(ctx, id, 10000, "topup", "t1")
+		assert.Nil(t, err)
+	}
+
+	// transfer paralel ke dua arah sekaligus, saldo yang tidak cukup boleh gagal
+	var wg sync.WaitGroup
+	for i := 0; i < 300; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			from := ids[i%len(ids)]
+			to := ids[(i*7+1)%len(ids)]
+			if from == to {
+				to = ids[(i+1)%len(ids)]
+			}
+			_, err := walletService.Transfer(ctx, from, to, int64(i%50+1)*100)
+			if err != nil {
+				assert.Equal(t, service.ErrInsufficientBalance, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var total int64
+	err := db.Model(&model.Wallet{}).Select("sum(balance)").Where("id in ?", ids).Scan(&total).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(40000), total)
+
+	for _, id := range ids {
+		var wallet model.Wallet
+		err = db.Take(&wallet, "id = ?", id).Error
+		assert.Nil(t, err)
+		assert.False(t, wallet.Balance.IsNegative())
+
+		balance, err := walletService.RebuildBalance(ctx, id)
+		assert.Nil(t, err)
+		assert.Equal(t, wallet.Balance.Amount, balance)
+	}
+}
+
+func TestIdempotentWalletOperation(t *testing.T) {
+	user := model.User{Id: "930", Password: "rahasia", Name: model.Name{FirstName: "User 930"}}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+
+	wallet, err := walletService.CreateWallet(ctx, "create-wallet-930", model.Wallet{Id: "930", UserId: "930"})
+	assert.Nil(t, err)
+	assert.Equal(t, "930", wallet.Id)
+
+	// request create yang diulang tidak membuat wallet baru
+	wallet, err = walletService.CreateWallet(ctx, "create-wallet-930", model.Wallet{Id: "930", UserId: "930"})
+	assert.Nil(t, err)
+	assert.Equal(t, "930", wallet.Id)
+
+	// wallet yang bentrok dengan key baru adalah konflik sungguhan, tidak dicoba ulang
+	calls := 0
+	_, err = service.RunIdempotent(ctx, db, "create-wallet-930-again", "930", func(tx *gorm.DB) (*model.Wallet, error) {
+		calls++
+		wallet := model.Wallet{Id: "930", UserId: "930", Currency: "USD"}
+		return &wallet, tx.Create(&wallet).Error
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+
+	first, err := walletService.CreditIdempotent(ctx, "credit-930", "930", 1000, "topup", "t1")
+	assert.Nil(t, err)
+
+	replay, err := walletService.CreditIdempotent(ctx, "credit-930", "930", 1000, "topup", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, first.ID, replay.ID)
+
+	// key yang sama dengan payload berbeda ditolak
+	_, err = walletService.CreditIdempotent(ctx, "credit-930", "930", 2000, "topup", "t1")
+	assert.Equal(t, service.ErrIdempotencyKeyMismatch, err)
+
+	var balance int64
+	err = db.Model(&model.Wallet{}).Select("balance").Where("id = ?", "930").Scan(&balance).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), balance)
+
+	// operasi yang gagal tidak menyimpan key sehingga bisa dicoba lagi
+	_, err = walletService.DebitIdempotent(ctx, "debit-930", "930", 5000, "purchase", "o1")
+	assert.Equal(t, service.ErrInsufficientBalance, err)
+
+	var count int64
+	err = db.Model(&model.IdempotencyKey{}).Where("idempotency_key = ?", "debit-930").Count(&count).Error
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+// request bersamaan dengan key yang sama bisa saling deadlock saat insert key,
+// semuanya harus mendapat hasil yang sama dan credit hanya dijalankan sekali
+func TestIdempotentConcurrent(t *testing.T) {
+	user := model.User{Id: "931", Password: "rahasia", Name: model.Name{FirstName: "User 931"}, Wallets: []model.Wallet{{Id: "931", UserId: "931"}}}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	entries := make([]*model.WalletEntry, 8)
+	errs := make([]error, len(entries))
+	var group sync.WaitGroup
+	for i := range entries {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			entries[i], errs[i] = walletService.CreditIdempotent(ctx, "credit-931", "931", 1000, "topup", "t1")
+		}(i)
+	}
+	group.Wait()
+
+	for i := range entries {
+		assert.Nil(t, errs[i])
+		if errs[i] == nil {
+			assert.Equal(t, entries[0].ID, entries[i].ID)
+		}
+	}
+
+	var wallet model.Wallet
+	err = db.Take(&wallet, "id = ?", "931").Error
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(1000, "IDR"), wallet.Balance)
+}
+
+func TestWalletHold(t *testing.T) {
+	user := model.User{Id: "950", Password: "rahasia", Name: model.Name{FirstName: "User 950"}, Wallets: []model.Wallet{{Id: "950", UserId: "950"}}}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	_, err = walletService.Credit(ctx, "950", 1000, "topup", "t1")
+	assert.Nil(t, err)
+
+	hold, err := walletService.Authorize(ctx, "950", money.New(600, "IDR"), time.Hour)
+	assert.Nil(t, err)
+
+	available, err := walletService.AvailableBalance(ctx, "950")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(400), available)
+
+	// dana yang ditahan tidak bisa dipakai debit atau hold lain
+	_, err = walletService.Debit(ctx, "950", 500, "purchase", "o1")
+	assert.Equal(t, service.ErrInsufficientBalance, err)
+	_, err = walletService.Authorize(ctx, "950", money.New(500, "IDR"), time.Hour)
+	assert.Equal(t, service.ErrInsufficientBalance, err)
+
+	// hold harus dalam mata uang wallet
+	_, err = walletService.Authorize(ctx, "950", money.New(100, "USD"), time.Hour)
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+	_, err = walletService.Capture(ctx, hold.ID, money.New(100, "USD"))
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+
+	// partial capture, sisa hold dilepas
+	entry, err := walletService.Capture(ctx, hold.ID, money.New(450, "IDR"))
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(550, "IDR"), entry.BalanceAfter)
+
+	_, err = walletService.Capture(ctx, hold.ID, money.New(100, "IDR"))
+	assert.Equal(t, service.ErrHoldNotActive, err)
+
+	hold, err = walletService.Authorize(ctx, "950", money.New(500, "IDR"), time.Hour)
+	assert.Nil(t, err)
+	err = walletService.Void(ctx, hold.ID)
+	assert.Nil(t, err)
+
+	available, err = walletService.AvailableBalance(ctx, "950")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(550), available)
+
+	// hold yang kadaluarsa tidak lagi menahan dana
+	_, err = walletService.Authorize(ctx, "950", money.New(550, "IDR"), time.Hour)
+	assert.Nil(t, err)
+	expired, err := walletService.ExpireHolds(ctx, time.Now().Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), expired)
+
+	available, err = walletService.AvailableBalance(ctx, "950")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(550), available)
+}
+
+func TestWalletHoldConcurrent(t *testing.T) {
+	user := model.User{Id: "951", Password: "rahasia", Name: model.Name{FirstName: "User 951"}, Wallets: []model.Wallet{{Id: "951", UserId: "951"}}}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	_, err = walletService.Credit(ctx, "951", 1000, "topup", "t1")
+	assert.Nil(t, err)
+
+	// 50 hold paralel @100, hanya 10 yang boleh berhasil
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	success := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := walletService.Authorize(ctx, "951", money.New(100, "IDR"), time.Hour)
+			if err == nil {
+				mutex.Lock()
+				success++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 10, success)
+
+	available, err := walletService.AvailableBalance(ctx, "951")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), available)
+}
+
+func TestWalletStatement(t *testing.T) {
+	user := model.User{Id: "960", Password: "rahasia", Name: model.Name{FirstName: "User 960"}, Wallets: []model.Wallet{{Id: "960", UserId: "960"}}}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	// entry lama sebelum periode statement
+	wib := time.FixedZone("WIB", 7*60*60)
+	from := time.Date(2023, 8, 1, 0, 0, 0, 0, wib)
+	entries := []model.WalletEntry{
+		{WalletId: "960", Amount: money.New(5000, "IDR"), BalanceAfter: money.New(5000, "IDR"), ReferenceType: "topup", ReferenceId: "t1", CreatedAt: from.Add(-time.Hour)},
+		{WalletId: "960", Amount: money.New(2000, "IDR"), BalanceAfter: money.New(7000, "IDR"), ReferenceType: "topup", ReferenceId: "t2", CreatedAt: from.Add(time.Hour)},
+		{WalletId: "960", Amount: money.New(-1500, "IDR"), BalanceAfter: money.New(5500, "IDR"), ReferenceType: "purchase", ReferenceId: "o1", CreatedAt: from.Add(2 * time.Hour)},
+		{WalletId: "960", Amount: money.New(100, "IDR"), BalanceAfter: money.New(5600, "IDR"), ReferenceType: "topup", ReferenceId: "t3", CreatedAt: from.AddDate(0, 1, 0)},
+	}
+	err = db.Create(&entries).Error
+	assert.Nil(t, err)
+
+	walletService := service.NewWalletService(db)
+	statement, err := walletService.Statement(context.Background(), "960", from, from.AddDate(0, 1, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5000), statement.OpeningBalance)
+	assert.Equal(t, int64(5500), statement.ClosingBalance)
+	assert.Equal(t, int64(2000), statement.TotalCredit)
+	assert.Equal(t, int64(1500), statement.TotalDebit)
+	assert.Equal(t, 2, len(statement.Lines))
+	assert.Equal(t, "01:00", statement.Lines[0].Time.Format("15:04"))
+
+	var buffer bytes.Buffer
+	err = statement.WriteCSV(&buffer)
+	assert.Nil(t, err)
+	assert.Contains(t, buffer.String(), "2023-08-01T01:00:00+07:00,2000,7000,topup,t2")
+
+	buffer.Reset()
+	err = statement.WriteText(&buffer)
+	assert.Nil(t, err)
+	assert.Contains(t, buffer.String(), "IDR 5500")
+
+	buffer.Reset()
+	err = statement.WriteJSON(&buffer)
+	assert.Nil(t, err)
+	assert.Contains(t, buffer.String(), `"closing_balance": 5500`)
+
+	_, err = walletService.Statement(context.Background(), "960", from, from)
+	assert.Equal(t, service.ErrInvalidPeriod, err)
+}
+
+func TestReconcile(t *testing.T) {
+	// balance diisi langsung tanpa lewat ledger
+	user := model.User{Id: "970", Password: "rahasia", Name: model.Name{FirstName: "User 970"}, Wallets: []model.Wallet{{Id: "970", UserId: "970"}}}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+	err = db.Table("wallets").Where("id = ?", "970").UpdateColumn("balance", 1000).Error
+	assert.Nil(t, err)
+
+	// balance awal saat wallet dibuat dicatat sebagai entry opening, jadi cocok dengan ledger
+	opened := model.Wallet{Id: "973", UserId: "970", Balance: money.New(500, "EUR")}
+	err = db.Create(&opened).Error
+	assert.Nil(t, err)
+
+	// user 971 di soft delete tanpa walletnya, lalu walletnya masih menerima entry
+	deletedAt := time.Now().Add(-time.Hour)
+	orphan := model.User{Id: "971", Password: "rahasia", Name: model.Name{FirstName: "User 971"}, Wallets: []model.Wallet{{Id: "971", UserId: "971"}}}
+	err = db.Create(&orphan).Error
+	assert.Nil(t, err)
+	err = db.Model(&orphan).UpdateColumn("deleted_at", deletedAt).Error
+	assert.Nil(t, err)
+	entry := model.WalletEntry{WalletId: "971", Amount: money.New(0, "IDR"), BalanceAfter: money.New(0, "IDR"), ReferenceType: "topup", ReferenceId: "t971"}
+	err = db.Create(&entry).Error
+	assert.Nil(t, err)
+
+	// wallet yang sudah di soft delete tetap dicocokkan dengan ledgernya
+	deleted := model.Wallet{Id: "972", UserId: "970", Currency: "USD"}
+	err = db.Create(&deleted).Error
+	assert.Nil(t, err)
+	err = db.Table("wallets").Where("id = ?", "972").UpdateColumn("balance", 300).Error
+	assert.Nil(t, err)
+	err = db.Delete(&deleted).Error
+	assert.Nil(t, err)
+
+	walletService := service.NewWalletService(db)
+	report, err := walletService.Reconcile(context.Background(), false)
+	assert.Nil(t, err)
+	assert.Contains(t, report.Mismatches, service.BalanceMismatch{WalletId: "970", Balance: 1000, LedgerBalance: 0})
+	assert.Contains(t, report.Mismatches, service.BalanceMismatch{WalletId: "972", Balance: 300, LedgerBalance: 0})
+	for _, mismatch := range report.Mismatches {
+		assert.NotEqual(t, "973", mismatch.WalletId)
+	}
+	assert.Contains(t, report.OrphanWallets, "971")
+	assert.Contains(t, report.OrphanEntries, entry.ID)
+	assert.True(t, report.HasIssues())
+
+	report, err = walletService.Reconcile(context.Background(), true)
+	assert.Nil(t, err)
+	assert.True(t, report.Fixed > 0)
+
+	balance, err := walletService.RebuildBalance(context.Background(), "970")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), balance)
+
+	balance, err = walletService.RebuildBalance(context.Background(), "973")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(500), balance)
+
+	report, err = walletService.Reconcile(context.Background(), false)
+	assert.Nil(t, err)
+	assert.NotContains(t, report.Mismatches, service.BalanceMismatch{WalletId: "970", Balance: 1000, LedgerBalance: 0})
+	assert.NotContains(t, report.Mismatches, service.BalanceMismatch{WalletId: "972", Balance: 300, LedgerBalance: 0})
+}
+
+func TestWalletTier(t *testing.T) {
+	user := model.User{Id: "980", Password: "rahasia", Name: model.Name{FirstName: "User 980"}, Wallets: []model.Wallet{{Id: "980", UserId: "980"}}}
+	err := db.Create(&user).Error
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	start := time.Now().Add(-time.Minute)
+
+	var wallets []model.Wallet
+	err = db.Scopes(service.Tier("broke")).Where("id = ?", "980").Find(&wallets).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(wallets))
+
+	_, err = walletService.Credit(ctx, "980", 1000, "topup", "t1")
+	assert.Nil(t, err)
+	_, err = walletService.Credit(ctx, "980", 5000, "topup", "t2")
+	assert.Nil(t, err)
+
+	err = db.Scopes(service.Tier("sultan")).Where("id = ?", "980").Find(&wallets).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(wallets))
+
+	changes, err := walletService.TierChanges(ctx, start, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	var tiers []string
+	for _, change := range changes {
+		if change.WalletId == "980" {
+			tiers = append(tiers, change.FromTier+">"+change.ToTier)
+		}
+	}
+	assert.Equal(t, []string{"broke>regular", "regular>sultan"}, tiers)
+
+	movements, err := walletService.TierMovements(ctx, start, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	var toSultan int64
+	for _, movement := range movements {
+		if movement.FromTier == "regular" && movement.ToTier == "sultan" {
+			toSultan = movement.Users
+		}
+	}
+	assert.True(t, toSultan >= 1)
+
+	counts, err := walletService.TierDistribution(ctx, 1)
+	assert.Nil(t, err)
+	found := false
+	for _, count := range counts {
+		assert.True(t, count.Wallets >= 1)
+		if count.Tier == "sultan" {
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	max := int64(10000)
+	err = walletService.SaveTier(ctx, &model.WalletTier{Name: "crazy rich", MinBalance: 9000, MaxBalance: &max})
+	assert.Equal(t, service.ErrTierOverlap, err)
+
+	err = walletService.SaveTier(ctx, &model.WalletTier{Name: "crazy rich", MinBalance: 9000, MaxBalance: new(int64)})
+	assert.Equal(t, service.ErrInvalidTierRange, err)
+}
+
+func TestScheduledTransfer(t *testing.T) {
+	for _, id := range []string{"990", "991"} {
+		user := model.User{Id: id, Password: "rahasia", Name: model.Name{FirstName: "User " + id}, Wallets: []model.Wallet{{Id: id, UserId: id}}}
+		err := db.Create(&user).Error
+		assert.Nil(t, err)
+	}
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	_, err := walletService.Credit(ctx, "990", 100000, "topup", "t1")
+	assert.Nil(t, err)
+
+	now := time.Date(2026, time.January, 1, 10, 0, 0, 0, time.Local)
+	scheduler := service.NewTransferScheduler(db)
+	scheduler.Now = func() time.Time { return now }
+
+	_, err = scheduler.Schedule(ctx, "990", "991", money.New(50000, "IDR"), "every minute", now)
+	assert.ErrorIs(t, err, service.ErrInvalidSchedule)
+	_, err = scheduler.Schedule(ctx, "990", "991", money.New(500, "USD"), "monthly:31", now)
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+
+	scheduled, err := scheduler.Schedule(ctx, "990", "991", money.New(50000, "IDR"), "monthly:31", time.Date(2026, time.January, 31, 9, 0, 0, 0, time.Local))
+	assert.Nil(t, err)
+
+	// belum jatuh tempo
+	report, err := scheduler.RunDue(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, report.Claimed)
+
+	// beberapa instance berjalan bersamaan, transfer hanya boleh terjadi sekali
+	now = time.Date(2026, time.January, 31, 9, 30, 0, 0, time.Local)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	succeeded := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			instance := service.NewTransferScheduler(db)
+			instance.Now = scheduler.Now
+			instance.Instance = "instance-" + strconv.Itoa(i)
+			report, err := instance.RunDue(ctx)
+			assert.Nil(t, err)
+			mutex.Lock()
+			succeeded += report.Succeeded
+			mutex.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, succeeded)
+
+	var wallet model.Wallet
+	err = db.Take(&wallet, "id = ?", "991").Error
+	assert.Nil(t, err)
+	assert.Equal(t, money.New(50000, "IDR"), wallet.Balance)
+
+	// tanggal 31 di bulan februari jatuh ke tanggal terakhir
+	err = db.Take(scheduled, "id = ?", scheduled.ID).Error
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, time.February, 28, 9, 0, 0, 0, time.Local), scheduled.NextRunAt.In(time.Local))
+
+	now = time.Date(2026, time.February, 28, 9, 0, 0, 0, time.Local)
+	report, err = scheduler.RunDue(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Succeeded)
+
+	// saldo habis, eksekusi dicatat gagal dan jadwal tetap maju
+	now = time.Date(2026, time.March, 31, 9, 0, 0, 0, time.Local)
+	report, err = scheduler.RunDue(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Failed)
+
+	var runs []model.ScheduledTransferRun
+	err = db.Where("scheduled_transfer_id = ?", scheduled.ID).Order("scheduled_at asc").Find(&runs).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(runs))
+	assert.Equal(t, service.RunFailed, runs[2].Status)
+	assert.Equal(t, service.ErrInsufficientBalance.Error(), runs[2].FailureReason)
+
+	err = db.Take(scheduled, "id = ?", scheduled.ID).Error
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, time.April, 30, 9, 0, 0, 0, time.Local), scheduled.NextRunAt.In(time.Local))
+	assert.Equal(t, service.ErrInsufficientBalance.Error(), scheduled.LastError)
+}
+
+func TestWalletFreeze(t *testing.T) {
+	for _, id := range []string{"1000", "1001"} {
+		user := model.User{Id: id, Password: "rahasia", Name: model.Name{FirstName: "User " + id}, Wallets: []model.Wallet{{Id: id, UserId: id}}}
+		err := db.Create(&user).Error
+		assert.Nil(t, err)
+	}
+
+	ctx := context.Background()
+	walletService := service.NewWalletService(db)
+	_, err := walletService.Credit(ctx, "1000", 1000, "topup", "t1")
+	assert.Nil(t, err)
+
+	err = walletService.FreezeWallet(ctx, "1000", "admin", "")
+	assert.Equal(t, service.ErrReasonRequired, err)
+
+	err = walletService.FreezeWallet(ctx, "1000", "admin", "investigasi fraud")
+	assert.Nil(t, err)
+
+	_, err = walletService.Debit(ctx, "1000", 100, "purchase", "o1")
+	assert.ErrorIs(t, err, service.ErrWalletFrozen)
+	_, err = walletService.Credit(ctx, "1000", 100, "topup", "t2")
+	assert.ErrorIs(t, err, service.ErrWalletFrozen)
+	_, err = walletService.Transfer(ctx, "1000", "1001", 100)
+	assert.ErrorIs(t, err, service.ErrWalletFrozen)
+	_, err = walletService.Authorize(ctx, "1000", money.New(100, "IDR"), time.Minute)
+	assert.ErrorIs(t, err, service.ErrWalletFrozen)
+
+	err = walletService.FreezeWallet(ctx, "1000", "admin", "investigasi fraud")
+	assert.ErrorIs(t, err, service.ErrInvalidWalletStatus)
+
+	err = walletService.UnfreezeWallet(ctx, "1000", "supervisor", "investigasi selesai")
+	assert.Nil(t, err)
+
+	_, err = walletService.Transfer(ctx, "1000", "1001", 1000)
+	assert.Nil(t, err)
+
+	err = walletService.CloseWallet(ctx, "1001", "admin", "permintaan user")
+	assert.Equal(t, service.ErrWalletNotEmpty, err)
+
+	err = walletService.CloseWallet(ctx, "1000", "admin", "permintaan user")
+	assert.Nil(t, err)
+
+	_, err = walletService.Credit(ctx, "1000", 100, "topup", "t3")
+	assert.ErrorIs(t, err, service.ErrWalletClosed)
+
+	err = walletService.UnfreezeWallet(ctx, "1000", "admin", "salah tutup")
+	assert.ErrorIs(t, err, service.ErrInvalidWalletStatus)
+
+	history, err := walletService.WalletStatusHistory(ctx, "1000")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(history))
+	assert.Equal(t, service.WalletFrozen, history[0].ToStatus)
+	assert.Equal(t, "admin", history[0].Actor)
+	assert.Equal(t, "investigasi fraud", history[0].Reason)
+	assert.Equal(t, service.WalletActive, history[1].ToStatus)
+	assert.Equal(t, "supervisor", history[1].Actor)
+	assert.Equal(t, service.WalletClosed, history[2].ToStatus)
+}